@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+)
+
+// fuzzer randomly mutates outgoing requests to shake out parser bugs on the
+// server. Each part of the request (headers, query string, body) is mutated
+// independently with probability rate.
+type fuzzer struct {
+	rate float64
+}
+
+// mutate applies zero or more random mutations to req and reports whether
+// anything was changed.
+func (f *fuzzer) mutate(req *http.Request) bool {
+	mutated := false
+	if rand.Float64() < f.rate {
+		f.mutateHeaders(req)
+		mutated = true
+	}
+	if rand.Float64() < f.rate {
+		f.mutateQuery(req)
+		mutated = true
+	}
+	if rand.Float64() < f.rate {
+		f.mutateBody(req)
+		mutated = true
+	}
+	return mutated
+}
+
+func (f *fuzzer) mutateHeaders(req *http.Request) {
+	switch rand.IntN(4) {
+	case 0:
+		// Lots of small headers.
+		for i := range 50 + rand.IntN(150) {
+			req.Header.Add(fmt.Sprintf("X-Fuzz-%d", i), randomToken(8))
+		}
+	case 1:
+		// One very large header value.
+		req.Header.Set("X-Fuzz-Large", strings.Repeat("A", 8<<10+rand.IntN(56<<10)))
+	case 2:
+		// obs-text bytes, which are valid on the wire but not valid UTF-8.
+		req.Header.Set("X-Fuzz-Bytes", string(invalidUTF8(16+rand.IntN(256))))
+	case 3:
+		// Conflicting or unusual content metadata.
+		req.Header.Add("Content-Type", "application/json; charset=utf-16")
+		req.Header.Add("Content-Type", "text/plain; charset="+randomToken(6))
+		req.Header.Set("Accept-Encoding", randomToken(12))
+	}
+}
+
+func (f *fuzzer) mutateQuery(req *http.Request) {
+	switch rand.IntN(4) {
+	case 0:
+		// Percent-encoded invalid UTF-8.
+		q := req.URL.Query()
+		q.Add("fuzz", string(invalidUTF8(8+rand.IntN(64))))
+		req.URL.RawQuery = q.Encode()
+	case 1:
+		// Malformed escape sequences.
+		req.URL.RawQuery = "a=%zz&b=%&c=%f&%%=1"
+	case 2:
+		// A very long query string.
+		req.URL.RawQuery = "q=" + strings.Repeat("x", 4<<10+rand.IntN(60<<10))
+	case 3:
+		// The same key repeated many times.
+		var b strings.Builder
+		for i := range 100 + rand.IntN(900) {
+			if i > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString("k=")
+			b.WriteString(randomToken(4))
+		}
+		req.URL.RawQuery = b.String()
+	}
+}
+
+func (f *fuzzer) mutateBody(req *http.Request) {
+	var body []byte
+	switch rand.IntN(4) {
+	case 0:
+		// Random bytes with a size spread over several orders of magnitude.
+		body = make([]byte, 1<<rand.IntN(21))
+		for i := range body {
+			body[i] = byte(rand.UintN(256))
+		}
+	case 1:
+		// Invalid UTF-8 labelled as JSON.
+		body = invalidUTF8(64 + rand.IntN(4096))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	case 2:
+		// Truncated JSON.
+		body = []byte(`{"id": 1, "items": [1, 2, {"nested": "val`)
+		req.Header.Set("Content-Type", "application/json")
+	case 3:
+		// Declared gzip encoding over a plain body.
+		body = []byte(strings.Repeat("not gzip ", 1+rand.IntN(512)))
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+const tokenChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+
+// randomToken returns n characters that are safe to use in header names.
+func randomToken(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = tokenChars[rand.IntN(len(tokenChars))]
+	}
+	return string(b)
+}
+
+// invalidUTF8 returns n bytes drawn from 0x80-0xBF. These are continuation
+// bytes only, so the result is never valid UTF-8.
+func invalidUTF8(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = 0x80 + byte(rand.UintN(0x40))
+	}
+	return b
+}
+
+// fuzzGenerator wraps another RequestGenerator and mutates the requests it
+// produces, counting mutated requests in st.
+type fuzzGenerator struct {
+	next RequestGenerator
+	f    *fuzzer
+	st   *stats
+}
+
+func (g *fuzzGenerator) Next(ctx context.Context) (*http.Request, error) {
+	req, err := g.next.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if g.f.mutate(req) {
+		g.st.mutated.Add(1)
+	}
+	return req, nil
+}
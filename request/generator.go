@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// RequestGenerator produces the requests sent by the load loop. Next is called
+// concurrently from every request goroutine, so implementations must be safe
+// for concurrent use.
+type RequestGenerator interface {
+	Next(ctx context.Context) (*http.Request, error)
+}
+
+// GeneratorConfig is passed to a GeneratorFactory when the run starts.
+type GeneratorConfig struct {
+	// URL is the target given with -url.
+	URL string
+	// Options holds the key=value pairs given with -generator-opts.
+	Options map[string]string
+}
+
+// GeneratorFactory builds a RequestGenerator for a run.
+type GeneratorFactory func(cfg GeneratorConfig) (RequestGenerator, error)
+
+var generators = newRegistry[GeneratorFactory]("generator")
+
+// RegisterGenerator makes a generator available under name for the -generator
+// flag. Custom generators are compiled in by adding a file to this package
+// that calls RegisterGenerator from an init function. It panics if name is
+// registered twice.
+func RegisterGenerator(name string, factory GeneratorFactory) {
+	generators.register(name, factory)
+}
+
+// newGenerator looks up a registered generator by name and builds it.
+func newGenerator(name string, cfg GeneratorConfig) (RequestGenerator, error) {
+	factory, err := generators.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return factory(cfg)
+}
+
+func init() {
+	RegisterGenerator("default", newDefaultGenerator)
+}
+
+// defaultGenerator sends the same request to the target URL every time, tagged
+// with a fresh x-mgc-test-id. The "method" and "body" options change the
+// request method and body.
+type defaultGenerator struct {
+	url    string
+	method string
+	body   string
+}
+
+func newDefaultGenerator(cfg GeneratorConfig) (RequestGenerator, error) {
+	g := &defaultGenerator{url: cfg.URL, method: http.MethodGet}
+	if m, ok := cfg.Options["method"]; ok {
+		g.method = strings.ToUpper(m)
+	}
+	g.body = cfg.Options["body"]
+	return g, nil
+}
+
+func (g *defaultGenerator) Next(ctx context.Context) (*http.Request, error) {
+	var body io.Reader
+	if g.body != "" {
+		body = strings.NewReader(g.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, g.method, g.url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("x-mgc-test-id", uuid.New().String())
+	return req, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeMarkdown writes r as GitHub-flavoured Markdown tables, ready to paste
+// into a pull request or an incident doc: the throughput and latencies, the
+// outcomes of the requests and the flags the run was started with.
+func writeMarkdown(w io.Writer, r report, flags *flag.FlagSet) {
+	fmt.Fprintf(w, "## Load test summary\n\n")
+	fmt.Fprintf(w, "| Metric | Value |\n|---|---:|\n")
+	fmt.Fprintf(w, "| Duration | %.1fs |\n", r.Seconds)
+	fmt.Fprintf(w, "| Requests | %d |\n", r.Requests)
+	fmt.Fprintf(w, "| RPS | %.1f |\n", r.RPS)
+	fmt.Fprintf(w, "| Latency mean | %.2f ms |\n", r.Latency.Mean)
+	fmt.Fprintf(w, "| Latency p50 | %.2f ms |\n", r.Latency.P50)
+	fmt.Fprintf(w, "| Latency p90 | %.2f ms |\n", r.Latency.P90)
+	fmt.Fprintf(w, "| Latency p99 | %.2f ms |\n", r.Latency.P99)
+
+	fmt.Fprintf(w, "\n### Outcomes\n\n")
+	fmt.Fprintf(w, "| Outcome | Requests | Share |\n|---|---:|---:|\n")
+	for o := outcome(0); o < numOutcomes; o++ {
+		n := r.Outcomes[o.String()]
+		if n == 0 && o != outcomeOK {
+			continue
+		}
+		share := 0.0
+		if r.Requests > 0 {
+			share = 100 * float64(n) / float64(r.Requests)
+		}
+		fmt.Fprintf(w, "| %s | %d | %.2f%% |\n", o, n, share)
+	}
+
+	fmt.Fprintf(w, "\n### Configuration\n\n")
+	fmt.Fprintf(w, "| Flag | Value |\n|---|---|\n")
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "version" {
+			return
+		}
+		fmt.Fprintf(w, "| `-%s` | %s |\n", f.Name, markdownCode(f.Value.String()))
+	})
+}
+
+// markdownCode formats s as inline code in a table cell, escaping the pipes
+// that would otherwise end the cell.
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.ReplaceAll(s, "|", `\|`) + "`"
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// registry maps names to factories for one kind of plugin (generators,
+// validators). It is safe for concurrent use.
+type registry[F any] struct {
+	kind string
+	mu   sync.RWMutex
+	m    map[string]F
+}
+
+func newRegistry[F any](kind string) *registry[F] {
+	return &registry[F]{kind: kind, m: make(map[string]F)}
+}
+
+// register adds factory under name. It panics if name is registered twice.
+func (r *registry[F]) register(name string, factory F) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.m[name]; dup {
+		panic(fmt.Sprintf("requester: %s %q registered twice", r.kind, name))
+	}
+	r.m[name] = factory
+}
+
+// lookup returns the factory registered under name.
+func (r *registry[F]) lookup(name string) (F, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	factory, ok := r.m[name]
+	if !ok {
+		return factory, fmt.Errorf("unknown %s %q (available: %s)", r.kind, name, strings.Join(r.namesLocked(), ", "))
+	}
+	return factory, nil
+}
+
+func (r *registry[F]) namesLocked() []string {
+	names := make([]string, 0, len(r.m))
+	for name := range r.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseOptions parses a comma-separated list of key=value pairs.
+func parseOptions(s string) (map[string]string, error) {
+	opts := make(map[string]string)
+	if s == "" {
+		return opts, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid option %q, want key=value", kv)
+		}
+		opts[k] = v
+	}
+	return opts, nil
+}
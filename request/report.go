@@ -0,0 +1,48 @@
+package main
+
+import "time"
+
+// report is the JSON form of a snapshot, or of the difference between two
+// snapshots covering Seconds of wall time.
+type report struct {
+	Time     time.Time        `json:"time"`
+	Seconds  float64          `json:"seconds"`
+	Requests int64            `json:"requests"`
+	RPS      float64          `json:"rps"`
+	Outcomes map[string]int64 `json:"outcomes"`
+	Latency  latencyReport    `json:"latency_ms"`
+}
+
+// latencyReport holds latency figures in milliseconds.
+type latencyReport struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+}
+
+func newReport(s snapshot, elapsed time.Duration) report {
+	r := report{
+		Time:     s.At,
+		Seconds:  elapsed.Seconds(),
+		Requests: s.total(),
+		Outcomes: make(map[string]int64, numOutcomes),
+		Latency: latencyReport{
+			Mean: ms(s.mean()),
+			P50:  ms(s.quantile(0.50)),
+			P90:  ms(s.quantile(0.90)),
+			P99:  ms(s.quantile(0.99)),
+		},
+	}
+	if elapsed > 0 {
+		r.RPS = float64(r.Requests) / elapsed.Seconds()
+	}
+	for o := outcome(0); o < numOutcomes; o++ {
+		r.Outcomes[o.String()] = s.Counts[o]
+	}
+	return r
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -1,15 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 func main() {
@@ -20,11 +22,63 @@ func main() {
 	keepalive := flag.Bool("keepalive", false, "Whether to enable keepalive in http connections")
 	numRequests := flag.Int("n", 10, "Number of parallel requests to make")
 	ms := flag.Int("ms", 2000, "Ms")
+	generatorName := flag.String("generator", "default", "Name of the registered request generator to use")
+	generatorOpts := flag.String("generator-opts", "", "Comma-separated key=value options passed to the generator")
+	validatorNames := flag.String("validator", "", "Comma-separated list of registered response validators (status, json, contains, ...)")
+	validatorOpts := flag.String("validator-opts", "", "Comma-separated key=value options passed to the validators (e.g. status=200|204,contains=ok)")
+	streamAddr := flag.String("stream-addr", "", "If set, serve per-interval stats as JSON over a WebSocket on this address (e.g. :9090)")
+	streamInterval := flag.Duration("stream-interval", time.Second, "Interval between messages on the -stream-addr WebSocket")
+	fuzz := flag.Bool("fuzz", false, "Randomly mutate headers, query params and bodies to probe server robustness")
+	fuzzRate := flag.Float64("fuzz-rate", 0.5, "Probability (0-1) of mutating each part of a request in -fuzz mode")
+	output := flag.String("output", "text", "Format of the summary printed when the run is interrupted: text, or markdown for a GitHub-ready table")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
 	duration := time.Duration(*ms) * time.Millisecond
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println("requester", buildVersion())
+		return
+	}
+
+	if *output != "text" && *output != "markdown" {
+		log.Fatalf("Fatal Error: unknown -output %q (want text or markdown)", *output)
+	}
+	if *streamInterval <= 0 {
+		log.Fatalf("Fatal Error: -stream-interval must be positive, got %v", *streamInterval)
+	}
+
 	fmt.Printf("Starting %d parallel requests to %s...\n", *numRequests, *url)
 
+	st := &stats{}
+
+	// Build the request generator. Fuzzing wraps whichever generator was
+	// selected, so custom generators can be fuzzed too.
+	opts, err := parseOptions(*generatorOpts)
+	if err != nil {
+		log.Fatalf("Fatal Error: %v", err)
+	}
+	gen, err := newGenerator(*generatorName, GeneratorConfig{URL: *url, Options: opts})
+	if err != nil {
+		log.Fatalf("Fatal Error: %v", err)
+	}
+	if *fuzz {
+		gen = &fuzzGenerator{next: gen, f: &fuzzer{rate: *fuzzRate}, st: st}
+		fmt.Printf("Fuzz mode enabled (rate %.2f)\n", *fuzzRate)
+	}
+	vopts, err := parseOptions(*validatorOpts)
+	if err != nil {
+		log.Fatalf("Fatal Error: %v", err)
+	}
+	validator, err := newValidators(*validatorNames, vopts)
+	if err != nil {
+		log.Fatalf("Fatal Error: %v", err)
+	}
+	ctx := context.Background()
+
+	if *streamAddr != "" {
+		serveStream(ctx, *streamAddr, st, *streamInterval)
+	}
+
 	// --- 2. Create a reusable HTTP client ---
 	// It's much more efficient to create one client with a custom transport
 	// than using http.Get() in a loop (which uses the DefaultClient).
@@ -35,16 +89,28 @@ func main() {
 			MaxIdleConns:    *numRequests,
 			MaxConnsPerHost: *numRequests,
 			// A reasonable timeout for idle connections
-			IdleConnTimeout: 30 * time.Second,
+			IdleConnTimeout:   30 * time.Second,
 			DisableKeepAlives: !*keepalive,
 		},
-			// A total timeout for each request
+		// A total timeout for each request
 		Timeout: duration,
 	}
 
+	// The first Ctrl+C (or SIGTERM) stops the loop after the current batch
+	// and prints the summary; a second one exits at once.
+	stopping := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		close(stopping)
+	}()
+
 	// --- 3. Start the infinite loop ---
 	// This loop will continuously run batches of parallel requests.
 	fmt.Println("Starting request loop. Press Ctrl+C to stop.")
+	runStart := time.Now()
 	batchNumber := 1
 	for {
 		fmt.Printf("\n--- Starting Batch %d ---\n", batchNumber)
@@ -66,7 +132,7 @@ func main() {
 
 			// Launch a new goroutine (a lightweight thread)
 			// We pass 'i+1' as an ID for logging purposes.
-			go makeRequest(client, *url, i+1, &wg)
+			go makeRequest(ctx, client, gen, validator, i+1, st, &wg)
 		}
 
 		// --- 6. Wait for all requests in the batch ---
@@ -76,25 +142,53 @@ func main() {
 
 		duration := time.Since(start)
 		fmt.Printf("Batch %d: All %d requests completed in %v\n", batchNumber, *numRequests, duration)
+		fmt.Printf("Totals: %s\n", st)
 
 		batchNumber++
+		select {
+		case <-stopping:
+			printSummary(*output, st, time.Since(runStart))
+			return
+		default:
+		}
 	}
 }
 
-// makeRequest performs a single HTTP GET request and signals to the WaitGroup
-// when it's complete.
-func makeRequest(client *http.Client, url string, id int, wg *sync.WaitGroup) {
+// printSummary prints the totals of the whole run in the -output format.
+func printSummary(output string, st *stats, elapsed time.Duration) {
+	r := newReport(st.snapshot(), elapsed)
+	if output == "markdown" {
+		fmt.Println()
+		writeMarkdown(os.Stdout, r, flag.CommandLine)
+		return
+	}
+	fmt.Printf("\nSummary: %d requests in %.1fs (%.1f req/s), latency mean=%.2fms p50=%.2fms p90=%.2fms p99=%.2fms\n",
+		r.Requests, r.Seconds, r.RPS, r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P99)
+	fmt.Printf("Totals: %s\n", st)
+}
+
+// makeRequest sends the next request from gen, records its outcome in st and
+// signals to the WaitGroup when it's complete. If validator is non-nil its
+// verdict decides whether the response counts as ok or invalid.
+func makeRequest(ctx context.Context, client *http.Client, gen RequestGenerator, validator ResponseValidator, id int, st *stats, wg *sync.WaitGroup) {
 	// Defer wg.Done() to ensure it's called when this function exits,
 	// no matter what (even if it panics or returns early on an error).
 	defer wg.Done()
 
 	log.Printf("[Request %d] Starting...\n", id)
 
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("x-mgc-test-id", uuid.New().String())
-	// Perform the HTTP GET request
+	req, err := gen.Next(ctx)
+	if err != nil {
+		st.record(outcomeError, 0)
+		log.Printf("[Request %d] ERROR building request: %v\n", id, err)
+		return
+	}
+	// Perform the HTTP request. Latency covers the whole exchange, including
+	// reading the body.
+	reqStart := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		st.record(classifyErr(err), time.Since(reqStart))
 		log.Printf("[Request %d] ERROR: %v\n", id, err)
 		return
 	}
@@ -103,14 +197,35 @@ func makeRequest(client *http.Client, url string, id int, wg *sync.WaitGroup) {
 	// This is crucial to prevent resource (connection) leaks.
 	defer resp.Body.Close()
 
+	// Validators that look at the body get a bounded copy of it.
+	var body []byte
+	if validator != nil && validator.WantsBody() {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxValidatedBody))
+		if err != nil {
+			st.record(classifyErr(err), time.Since(reqStart))
+			log.Printf("[Request %d] ERROR reading body: %v\n", id, err)
+			return
+		}
+	}
+
 	// We must read and discard the response body to allow the
 	// underlying connection to be reused. io.Copy to io.Discard
 	// is the most efficient way to do this.
 	_, err = io.Copy(io.Discard, resp.Body)
 	if err != nil {
+		st.record(classifyErr(err), time.Since(reqStart))
 		log.Printf("[Request %d] ERROR reading body: %v\n", id, err)
 		return
 	}
 
+	if validator != nil {
+		if err := validator.Validate(resp, body); err != nil {
+			st.record(outcomeInvalid, time.Since(reqStart))
+			log.Printf("[Request %d] INVALID response: %v\n", id, err)
+			return
+		}
+	}
+	st.record(classifyStatus(resp.StatusCode), time.Since(reqStart))
+
 	log.Printf("[Request %d] Finished with status: %s\n", id, resp.Status)
 }
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// outcome classifies how a single request ended.
+type outcome int
+
+const (
+	outcomeOK      outcome = iota // 1xx, 2xx and 3xx responses
+	outcome4xx                    // client errors reported by the server
+	outcome5xx                    // server errors
+	outcomeClosed                 // connection closed or reset without a response
+	outcomeTimeout                // request exceeded the client timeout
+	outcomeError                  // any other transport or client-side error
+	outcomeInvalid                // rejected by a ResponseValidator
+	numOutcomes
+)
+
+var outcomeNames = [numOutcomes]string{"ok", "4xx", "5xx", "closed", "timeout", "error", "invalid"}
+
+func (o outcome) String() string {
+	return outcomeNames[o]
+}
+
+// classifyStatus maps an HTTP status code to an outcome.
+func classifyStatus(code int) outcome {
+	switch {
+	case code >= 500:
+		return outcome5xx
+	case code >= 400:
+		return outcome4xx
+	default:
+		return outcomeOK
+	}
+}
+
+// classifyErr maps an error returned by http.Client.Do (or while reading the
+// body) to an outcome, separating abrupt closes from timeouts.
+func classifyErr(err error) outcome {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return outcomeTimeout
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return outcomeClosed
+	}
+	return outcomeError
+}
+
+// Latencies are counted in logarithmic buckets: bucketsPerOctave buckets for
+// every doubling of the latency in microseconds, which keeps quantile error
+// around 9% while needing only a few hundred counters for latencies of up to
+// about half an hour.
+const (
+	bucketsPerOctave = 8
+	numBuckets       = 31 * bucketsPerOctave
+)
+
+// latencyBucket returns the histogram bucket for d.
+func latencyBucket(d time.Duration) int {
+	us := float64(d.Microseconds())
+	if us < 1 {
+		return 0
+	}
+	b := int(math.Log2(us) * bucketsPerOctave)
+	return min(b, numBuckets-1)
+}
+
+// bucketUpperBound returns the largest latency counted in bucket b.
+func bucketUpperBound(b int) time.Duration {
+	return time.Duration(math.Exp2(float64(b+1)/bucketsPerOctave)) * time.Microsecond
+}
+
+// stats holds counters shared by all request goroutines for the whole run.
+type stats struct {
+	counts     [numOutcomes]atomic.Int64
+	latency    [numBuckets]atomic.Int64
+	latencySum atomic.Int64 // nanoseconds
+	mutated    atomic.Int64
+}
+
+// record counts a request that ended with o after d.
+func (s *stats) record(o outcome, d time.Duration) {
+	s.counts[o].Add(1)
+	s.latency[latencyBucket(d)].Add(1)
+	s.latencySum.Add(int64(d))
+}
+
+// snapshot copies the current counters. Snapshots taken at two points in time
+// can be subtracted to get the activity in between.
+func (s *stats) snapshot() snapshot {
+	snap := snapshot{At: time.Now(), LatencySum: time.Duration(s.latencySum.Load())}
+	for i := range s.counts {
+		snap.Counts[i] = s.counts[i].Load()
+	}
+	for i := range s.latency {
+		snap.Latency[i] = s.latency[i].Load()
+	}
+	return snap
+}
+
+// String renders the counters as a single summary line.
+func (s *stats) String() string {
+	var b strings.Builder
+	for o := outcome(0); o < numOutcomes; o++ {
+		if o > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s=%d", o, s.counts[o].Load())
+	}
+	if n := s.mutated.Load(); n > 0 {
+		fmt.Fprintf(&b, " mutated=%d", n)
+	}
+	return b.String()
+}
+
+// snapshot is a point-in-time copy of stats.
+type snapshot struct {
+	At         time.Time
+	Counts     [numOutcomes]int64
+	Latency    [numBuckets]int64
+	LatencySum time.Duration
+}
+
+// sub returns the difference between s and an earlier snapshot.
+func (s snapshot) sub(prev snapshot) snapshot {
+	d := snapshot{At: s.At, LatencySum: s.LatencySum - prev.LatencySum}
+	for i := range s.Counts {
+		d.Counts[i] = s.Counts[i] - prev.Counts[i]
+	}
+	for i := range s.Latency {
+		d.Latency[i] = s.Latency[i] - prev.Latency[i]
+	}
+	return d
+}
+
+// total returns the number of requests in the snapshot.
+func (s snapshot) total() int64 {
+	var n int64
+	for _, c := range s.Counts {
+		n += c
+	}
+	return n
+}
+
+// mean returns the mean latency, or 0 if there were no requests.
+func (s snapshot) mean() time.Duration {
+	n := s.total()
+	if n == 0 {
+		return 0
+	}
+	return s.LatencySum / time.Duration(n)
+}
+
+// quantile returns an upper bound for the q-th latency quantile (0 < q <= 1),
+// or 0 if there were no requests.
+func (s snapshot) quantile(q float64) time.Duration {
+	n := s.total()
+	if n == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(n)))
+	var seen int64
+	for b, c := range s.Latency {
+		seen += c
+		if seen >= rank {
+			return bucketUpperBound(b)
+		}
+	}
+	return bucketUpperBound(numBuckets - 1)
+}
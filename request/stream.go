@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamMessage is sent to every WebSocket client once per interval.
+type streamMessage struct {
+	Interval report `json:"interval"`
+	Total    report `json:"total"`
+}
+
+// streamServer serves a WebSocket endpoint that pushes per-interval stats as
+// JSON, so dashboards can follow a run live.
+type streamServer struct {
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+}
+
+func newStreamServer() *streamServer {
+	return &streamServer{
+		upgrader: websocket.Upgrader{
+			// Dashboards are usually served from a different origin.
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+		clients: make(map[chan []byte]struct{}),
+	}
+}
+
+func (s *streamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response.
+		return
+	}
+	defer conn.Close()
+
+	ch := make(chan []byte, 16)
+	s.mu.Lock()
+	s.clients[ch] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, ch)
+		s.mu.Unlock()
+	}()
+
+	// We never expect messages from the client, but we must read to notice
+	// when it goes away.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-ch:
+			conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+// broadcast queues msg for every connected client. Clients that have fallen
+// behind miss the message rather than slowing down the run.
+func (s *streamServer) broadcast(msg []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.clients {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// run publishes interval and cumulative stats from st every interval until
+// ctx is cancelled.
+func (s *streamServer) run(ctx context.Context, st *stats, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	first := st.snapshot()
+	prev := first
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cur := st.snapshot()
+		msg, err := json.Marshal(streamMessage{
+			Interval: newReport(cur.sub(prev), cur.At.Sub(prev.At)),
+			Total:    newReport(cur.sub(first), cur.At.Sub(first.At)),
+		})
+		if err != nil {
+			log.Printf("ERROR encoding stream message: %v", err)
+			continue
+		}
+		s.broadcast(msg)
+		prev = cur
+	}
+}
+
+// serveStream starts the stats stream on addr in the background.
+func serveStream(ctx context.Context, addr string, st *stats, interval time.Duration) {
+	s := newStreamServer()
+	go s.run(ctx, st, interval)
+	go func() {
+		log.Printf("Streaming stats on ws://%s/", addr)
+		if err := http.ListenAndServe(addr, s); err != nil {
+			log.Fatalf("Fatal Error: stats stream: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxValidatedBody caps how much of a response body is buffered for
+// validators that want it. Anything beyond this is discarded unread.
+const maxValidatedBody = 10 << 20
+
+// ResponseValidator checks a single response. A non-nil error marks the
+// request as failed ("invalid") in the run's counters even if the transport
+// succeeded. Validate is called concurrently and must be safe for concurrent
+// use.
+type ResponseValidator interface {
+	// WantsBody reports whether Validate needs the response body. When no
+	// validator wants it, the body is discarded without being buffered.
+	WantsBody() bool
+	// Validate inspects the response. body is nil unless WantsBody returned
+	// true; resp.Body must not be read.
+	Validate(resp *http.Response, body []byte) error
+}
+
+// ValidatorFactory builds a ResponseValidator from the key=value pairs given
+// with -validator-opts.
+type ValidatorFactory func(opts map[string]string) (ResponseValidator, error)
+
+var validators = newRegistry[ValidatorFactory]("validator")
+
+// RegisterValidator makes a validator available under name for the -validator
+// flag, in the same way as RegisterGenerator. It panics if name is registered
+// twice.
+func RegisterValidator(name string, factory ValidatorFactory) {
+	validators.register(name, factory)
+}
+
+// newValidators builds the validators named in a comma-separated list. All of
+// them share the same options. An empty list returns nil.
+func newValidators(names string, opts map[string]string) (ResponseValidator, error) {
+	if names == "" {
+		return nil, nil
+	}
+	var all validatorChain
+	for _, name := range strings.Split(names, ",") {
+		factory, err := validators.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := factory(opts)
+		if err != nil {
+			return nil, fmt.Errorf("validator %s: %w", name, err)
+		}
+		all = append(all, v)
+	}
+	return all, nil
+}
+
+// validatorChain runs several validators and returns the first failure.
+type validatorChain []ResponseValidator
+
+func (c validatorChain) WantsBody() bool {
+	for _, v := range c {
+		if v.WantsBody() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c validatorChain) Validate(resp *http.Response, body []byte) error {
+	for _, v := range c {
+		if err := v.Validate(resp, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterValidator("status", newStatusValidator)
+	RegisterValidator("json", func(map[string]string) (ResponseValidator, error) { return jsonValidator{}, nil })
+	RegisterValidator("contains", newContainsValidator)
+}
+
+// statusValidator accepts only the status codes listed in the "status" option,
+// or any 2xx code if the option is absent.
+type statusValidator struct {
+	codes map[int]bool
+}
+
+func newStatusValidator(opts map[string]string) (ResponseValidator, error) {
+	v := statusValidator{}
+	if s, ok := opts["status"]; ok {
+		v.codes = make(map[int]bool)
+		for _, c := range strings.Split(s, "|") {
+			code, err := strconv.Atoi(c)
+			if err != nil {
+				return nil, fmt.Errorf("invalid status code %q", c)
+			}
+			v.codes[code] = true
+		}
+	}
+	return v, nil
+}
+
+func (statusValidator) WantsBody() bool { return false }
+
+func (v statusValidator) Validate(resp *http.Response, _ []byte) error {
+	if v.codes == nil {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+	if !v.codes[resp.StatusCode] {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// jsonValidator requires the body to be syntactically valid JSON.
+type jsonValidator struct{}
+
+func (jsonValidator) WantsBody() bool { return true }
+
+func (jsonValidator) Validate(_ *http.Response, body []byte) error {
+	if !json.Valid(body) {
+		return errors.New("body is not valid JSON")
+	}
+	return nil
+}
+
+// containsValidator requires the body to contain the "contains" option.
+type containsValidator struct {
+	needle []byte
+}
+
+func newContainsValidator(opts map[string]string) (ResponseValidator, error) {
+	s, ok := opts["contains"]
+	if !ok || s == "" {
+		return nil, errors.New(`missing "contains" option`)
+	}
+	return containsValidator{needle: []byte(s)}, nil
+}
+
+func (containsValidator) WantsBody() bool { return true }
+
+func (v containsValidator) Validate(_ *http.Response, body []byte) error {
+	if !bytes.Contains(body, v.needle) {
+		return fmt.Errorf("body does not contain %q", v.needle)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// version and commit identify the build. Release builds set them with the
+// linker, e.g.
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD)"
+//
+// Without it, commit falls back to the VCS revision stamped by go build.
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// buildVersion describes the build, e.g. "v1.2.0 (commit 1a2b3c4, go1.25.1)".
+func buildVersion() string {
+	rev := commit
+	if rev == "" {
+		rev = "unknown"
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range info.Settings {
+				if s.Key == "vcs.revision" && len(s.Value) >= 7 {
+					rev = s.Value[:7]
+				}
+			}
+		}
+	}
+	return version + " (commit " + rev + ", " + runtime.Version() + ")"
+}
@@ -0,0 +1,7 @@
+package main
+
+import "server/mockserver"
+
+func main() {
+	mockserver.Main()
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+var (
+	// accessLogger receives one record per request handled by
+	// Metrics.Handler; nil disables access logging.
+	accessLogger = slog.Default()
+	// accessLogRate is the fraction (0-1) of requests that are logged.
+	accessLogRate = 1.0
+	// keepErrors and keepSlowerThan select the requests logged whatever
+	// accessLogRate; keepSlowerThan is 0 to not keep slow requests.
+	keepErrors     bool
+	keepSlowerThan time.Duration
+)
+
+// SetAccessLog sets the logger used for access logs and the fraction of
+// requests (0-1) that get logged, so that logging does not dominate at high
+// request rates. A nil logger, or a rate of 0 without SetAccessLogKeep,
+// disables access logs. It must be called before serving.
+func SetAccessLog(logger *slog.Logger, sampleRate float64) {
+	accessLogger = logger
+	accessLogRate = sampleRate
+}
+
+// SetAccessLogKeep makes the sampling of SetAccessLog keep every failed
+// request (status 400 and above) if errors is set, and every request slower
+// than slow if it is positive, so that sampling away most successes at high
+// request rates does not hide the requests worth looking at. With a sample
+// rate of 0 only those requests are logged. It must be called before
+// serving.
+func SetAccessLogKeep(errors bool, slow time.Duration) {
+	keepErrors = errors
+	keepSlowerThan = slow
+}
+
+// logAccess writes the access log record for a finished request.
+func logAccess(r *http.Request, handlerLabel, proto string, srw *statusResponseWriter, latency time.Duration) {
+	if accessLogger == nil || !sampleAccess(srw.statusCode, latency) {
+		return
+	}
+	accessLogger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+		slog.String("request_id", requestID(r)),
+		slog.String("handler", handlerLabel),
+		slog.String("listener", listenerLabel(r)),
+		slog.String("tenant", tenantLabel(r)),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("proto", proto),
+		slog.Int("status", srw.statusCode),
+		slog.Int64("bytes", srw.bytes),
+		slog.Duration("latency", latency),
+		slog.String("remote_addr", r.RemoteAddr),
+		slog.String("user_agent", r.UserAgent()),
+	)
+}
+
+// sampleAccess reports whether a request with status and latency goes to
+// the access log.
+func sampleAccess(status int, latency time.Duration) bool {
+	switch {
+	case keepErrors && status >= 400:
+		return true
+	case keepSlowerThan > 0 && latency >= keepSlowerThan:
+		return true
+	case accessLogRate >= 1:
+		return true
+	}
+	return accessLogRate > 0 && rand.Float64() < accessLogRate
+}
+
+// requestID returns the ID of r, as set by the server's request ID middleware
+// or sent by the client.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-Id"); id != "" {
+		return id
+	}
+	return r.Header.Get("X-Mgc-Test-Id")
+}
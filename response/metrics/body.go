@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Bytes de corpo de requisição recebidos.
+	requestBodyBytesTotal = shared.NewCounter(
+		prometheus.CounterOpts{
+			Name: "go_server_http_request_body_bytes_total",
+			Help: "Total de bytes de corpo de requisição lidos pelo servidor.",
+		},
+	)
+
+	// Requisições recusadas por causa do corpo.
+	requestBodyRejectedTotal = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_http_request_body_rejected_total",
+			Help: "Total de requisições recusadas por causa do corpo (too_large ou invalid_json).",
+		},
+		[]string{"reason"},
+	)
+)
+
+// RequestBodyBytes counts n bytes of request body read by the server.
+func RequestBodyBytes(n int64) {
+	requestBodyBytesTotal.Add(float64(n))
+}
+
+// RequestBodyRejected counts a request refused because of its body, for
+// reason "too_large" or "invalid_json".
+func RequestBodyRejected(reason string) {
+	requestBodyRejectedTotal.WithLabelValues(reason).Inc()
+}
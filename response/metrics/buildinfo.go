@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Version and Commit identify the build of the server. Release builds set
+// them with the linker, e.g.
+//
+//	go build -ldflags "-X server/metrics.Version=v1.2.0 -X server/metrics.Commit=$(git rev-parse --short HEAD)"
+//
+// Without it, Commit falls back to the VCS revision stamped by go build.
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// BuildVersion describes the build, e.g. "v1.2.0 (commit 1a2b3c4, go1.25.1)".
+func BuildVersion() string {
+	return Version + " (commit " + commit() + ", " + runtime.Version() + ")"
+}
+
+// commit returns Commit, or the VCS revision of the build, or "unknown".
+func commit() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && len(s.Value) >= 7 {
+				return s.Value[:7]
+			}
+		}
+	}
+	return "unknown"
+}
+
+// startTime is when the process started.
+var startTime = time.Now()
+
+var (
+	// Informações do build, com valor constante 1, para anotar deploys nos
+	// dashboards.
+	_ = shared.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name:        "go_server_build_info",
+			Help:        "Versão, commit e versão do Go do servidor; o valor é sempre 1.",
+			ConstLabels: prometheus.Labels{"version": Version, "commit": commit(), "goversion": runtime.Version()},
+		},
+		func() float64 { return 1 },
+	)
+
+	// Início do processo e tempo no ar, também disponíveis em registros
+	// próprios, que não têm o coletor de processo.
+	_ = shared.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "go_server_start_time_seconds",
+			Help: "Momento de início do servidor, em segundos desde a época Unix.",
+		},
+		func() float64 { return float64(startTime.UnixNano()) / 1e9 },
+	)
+	_ = shared.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "go_server_uptime_seconds",
+			Help: "Tempo em segundos desde o início do servidor.",
+		},
+		func() float64 { return time.Since(startTime).Seconds() },
+	)
+)
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Consultas ao cache de respostas simulado (-response-cache-ttl).
+	responseCacheRequestsTotal = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_response_cache_requests_total",
+			Help: "Total de consultas ao cache de respostas, por resultado.",
+		},
+		[]string{"result"}, // hit, miss ou bypass
+	)
+
+	// Entradas removidas do cache de respostas.
+	responseCacheEvictionsTotal = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_response_cache_evictions_total",
+			Help: "Total de entradas removidas do cache de respostas, por motivo.",
+		},
+		[]string{"reason"}, // expired ou capacity
+	)
+
+	// Entradas atualmente no cache de respostas.
+	responseCacheEntries = shared.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "go_server_response_cache_entries",
+			Help: "Número de respostas guardadas no cache de respostas.",
+		},
+	)
+)
+
+// CacheRequest counts a lookup in the response cache by result: "hit",
+// "miss" or "bypass" (the client asked for a fresh response).
+func CacheRequest(result string) {
+	responseCacheRequestsTotal.WithLabelValues(result).Inc()
+}
+
+// CacheEviction counts an entry removed from the response cache because it
+// "expired" or to make room ("capacity").
+func CacheEviction(reason string) {
+	responseCacheEvictionsTotal.WithLabelValues(reason).Inc()
+}
+
+// SetCacheEntries reports the number of responses in the response cache.
+func SetCacheEntries(n int) {
+	responseCacheEntries.Set(float64(n))
+}
@@ -0,0 +1,20 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Requisições por IP de cliente, com cardinalidade limitada por
+// -client-stats (os demais clientes aparecem como "other").
+var clientRequestsTotal = shared.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "go_server_client_requests_total",
+		Help: "Total de requisições por IP de cliente (limitado; o excedente é contado como \"other\").",
+	},
+	[]string{"client"},
+)
+
+// ClientRequest counts a request from client, an IP address or "other".
+func ClientRequest(client string) {
+	clientRequestsTotal.WithLabelValues(client).Inc()
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Bytes das respostas antes da compressão.
+	compressionInputBytes = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_http_compression_input_bytes_total",
+			Help: "Total de bytes de respostas HTTP antes da compressão.",
+		},
+		[]string{"encoding"},
+	)
+
+	// Bytes das respostas depois da compressão.
+	compressionOutputBytes = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_http_compression_output_bytes_total",
+			Help: "Total de bytes de respostas HTTP depois da compressão.",
+		},
+		[]string{"encoding"},
+	)
+
+	// Bytes economizados pela compressão.
+	compressionSavedBytes = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_http_compression_saved_bytes_total",
+			Help: "Total de bytes economizados pela compressão de respostas HTTP.",
+		},
+		[]string{"encoding"},
+	)
+)
+
+// Compressed records a response body of in bytes that was sent as out bytes
+// with the given content encoding. Responses that grew are not counted as
+// savings.
+func Compressed(encoding string, in, out int64) {
+	compressionInputBytes.WithLabelValues(encoding).Add(float64(in))
+	compressionOutputBytes.WithLabelValues(encoding).Add(float64(out))
+	if in > out {
+		compressionSavedBytes.WithLabelValues(encoding).Add(float64(in - out))
+	}
+}
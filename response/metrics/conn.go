@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Conexões atualmente em cada estado (new, active, idle).
+	connections = shared.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "go_server_connections",
+			Help: "Número atual de conexões HTTP por estado (new, active, idle).",
+		},
+		[]string{"state"},
+	)
+
+	// Transições de estado das conexões.
+	connectionTransitions = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_connection_transitions_total",
+			Help: "Total de transições de conexões HTTP para cada estado (new, active, idle, hijacked, closed).",
+		},
+		[]string{"state"},
+	)
+
+	// Requisições atendidas por conexão até ela ser fechada, para medir o
+	// reuso de conexões keep-alive.
+	connectionRequests = shared.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "go_server_connection_requests",
+			Help:    "Número de requisições atendidas por conexão HTTP até seu fechamento.",
+			Buckets: []float64{0, 1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 10000},
+		},
+	)
+)
+
+type connRequestsKey struct{}
+
+// connRequests holds the request counters of the open connections set up
+// by ConnContext, until ConnState sees them close.
+var connRequests = struct {
+	sync.Mutex
+	m map[net.Conn]*atomic.Int64
+}{m: make(map[net.Conn]*atomic.Int64)}
+
+// ConnContext counts the requests served on c through Metrics.Handler, for
+// the requests per connection histogram recorded by ConnState. Use it as (or
+// call it from) http.Server.ConnContext, along with ConnState.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	n := new(atomic.Int64)
+	connRequests.Lock()
+	connRequests.m[c] = n
+	connRequests.Unlock()
+	return context.WithValue(ctx, connRequestsKey{}, n)
+}
+
+// countConnRequest counts a request on the connection serving ctx.
+func countConnRequest(ctx context.Context) {
+	if n, ok := ctx.Value(connRequestsKey{}).(*atomic.Int64); ok {
+		n.Add(1)
+	}
+}
+
+// connStates remembers the last gauged state of every open connection, so
+// ConnState can move it from one gauge to the next.
+var connStates = struct {
+	sync.Mutex
+	m map[net.Conn]http.ConnState
+}{m: make(map[net.Conn]http.ConnState)}
+
+// ConnState records connection lifecycle metrics. Use it as (or call it from)
+// http.Server.ConnState. Hijacked and closed connections leave the gauges and
+// are only counted.
+func ConnState(c net.Conn, state http.ConnState) {
+	connectionTransitions.WithLabelValues(state.String()).Inc()
+	if state == http.StateHijacked || state == http.StateClosed {
+		connRequests.Lock()
+		n, ok := connRequests.m[c]
+		delete(connRequests.m, c)
+		connRequests.Unlock()
+		if ok {
+			connectionRequests.Observe(float64(n.Load()))
+		}
+	}
+
+	connStates.Lock()
+	defer connStates.Unlock()
+	if prev, ok := connStates.m[c]; ok {
+		connections.WithLabelValues(prev.String()).Dec()
+	}
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(connStates.m, c)
+	default:
+		connStates.m[c] = state
+		connections.WithLabelValues(state.String()).Inc()
+	}
+}
@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 1 enquanto o servidor está numa fase de degradação programada.
+var degraded = shared.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "go_server_degraded",
+		Help: "1 durante as fases de degradação programada, 0 fora delas.",
+	},
+)
+
+// SetDegraded records whether a scheduled degradation phase is under way.
+func SetDegraded(on bool) {
+	if on {
+		degraded.Set(1)
+	} else {
+		degraded.Set(0)
+	}
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Conexões aceitas pelo listener de eco TCP.
+	echoConnectionsTotal = shared.NewCounter(
+		prometheus.CounterOpts{
+			Name: "go_server_echo_connections_total",
+			Help: "Total de conexões aceitas pelo listener de eco TCP.",
+		},
+	)
+
+	// Conexões de eco TCP abertas no momento.
+	echoConnectionsActive = shared.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "go_server_echo_connections_active",
+			Help: "Conexões abertas no listener de eco TCP.",
+		},
+	)
+
+	// Bytes ecoados por protocolo (tcp, udp).
+	echoBytesTotal = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_echo_bytes_total",
+			Help: "Total de bytes recebidos e devolvidos pelos listeners de eco.",
+		},
+		[]string{"proto"},
+	)
+
+	// Datagramas ecoados pelo listener UDP.
+	echoPacketsTotal = shared.NewCounter(
+		prometheus.CounterOpts{
+			Name: "go_server_echo_packets_total",
+			Help: "Total de datagramas devolvidos pelo listener de eco UDP.",
+		},
+	)
+)
+
+// EchoConnOpened records a connection accepted by the TCP echo listener.
+func EchoConnOpened() {
+	echoConnectionsTotal.Inc()
+	echoConnectionsActive.Inc()
+}
+
+// EchoConnClosed records the end of a TCP echo connection.
+func EchoConnClosed() {
+	echoConnectionsActive.Dec()
+}
+
+// EchoBytes counts n bytes echoed over proto ("tcp" or "udp").
+func EchoBytes(proto string, n int64) {
+	echoBytesTotal.WithLabelValues(proto).Add(float64(n))
+}
+
+// EchoPacket records a UDP datagram of n bytes echoed back.
+func EchoPacket(n int) {
+	echoPacketsTotal.Inc()
+	echoBytesTotal.WithLabelValues("udp").Add(float64(n))
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"expvar"
+	"time"
+)
+
+// Contadores principais também publicados via expvar (/debug/vars), para
+// verificações rápidas sem o Prometheus.
+var (
+	varRequests = new(expvar.Int)
+	varErrors   = new(expvar.Int)
+	varInFlight = new(expvar.Int)
+)
+
+// The counters of every Metrics of the process are published with expvar as
+// the "server" map: requests, errors (status 500 and above), in_flight and
+// uptime_seconds, e.g. for
+//
+//	curl -s localhost:8080/debug/vars | jq .server
+func init() {
+	vars := expvar.NewMap("server")
+	vars.Set("requests", varRequests)
+	vars.Set("errors", varErrors)
+	vars.Set("in_flight", varInFlight)
+	vars.Set("uptime_seconds", expvar.Func(func() any {
+		return int64(time.Since(startTime).Seconds())
+	}))
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Atrasos injetados, configurados ou pedidos pelo cliente.
+	injectedDelay = shared.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "go_server_injected_delay_seconds",
+			Help:    "Atrasos injetados nas respostas, em segundos, por origem (config ou override).",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2.5, 12),
+		},
+		[]string{"source"},
+	)
+
+	// Erros injetados por código e causa.
+	injectedErrors = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_injected_errors_total",
+			Help: "Total de erros injetados por código de status e causa (random, sequence, degraded, downstream ou override).",
+		},
+		[]string{"code", "cause"},
+	)
+
+	// Ações do modo caos.
+	chaosActions = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_chaos_actions_total",
+			Help: "Total de respostas quebradas pelo modo caos por modo e origem (random ou override).",
+		},
+		[]string{"mode", "source"},
+	)
+)
+
+// InjectedDelay records a delay injected into a response: source is config
+// for the configured delays (including latency ramps, degradation phases
+// and simulated downstream calls) and override for a delay the client
+// asked for. Zero delays are not recorded.
+func InjectedDelay(source string, d time.Duration) {
+	if d > 0 {
+		injectedDelay.WithLabelValues(source).Observe(d.Seconds())
+	}
+}
+
+// InjectedError records a response failed on purpose with code, for cause:
+// random, sequence, degraded, downstream or override.
+func InjectedError(cause string, code int) {
+	injectedErrors.WithLabelValues(strconv.Itoa(code), cause).Inc()
+}
+
+// ChaosAction records a response broken in chaos mode, picked at random or
+// asked for by the client (source override).
+func ChaosAction(mode, source string) {
+	chaosActions.WithLabelValues(mode, source).Inc()
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// Contador de chamadas gRPC, equivalente a go_server_http_requests_total.
+	grpcRequestsTotal = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_grpc_requests_total",
+			Help: "Total de chamadas gRPC unárias recebidas.",
+		},
+		[]string{"method", "code"},
+	)
+
+	// Duração das chamadas gRPC, equivalente a
+	// go_server_http_request_duration_seconds.
+	grpcRequestDuration = shared.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "go_server_grpc_request_duration_seconds",
+			Help:    "Duração (latência) das chamadas gRPC unárias em segundos.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method"},
+	)
+)
+
+// UnaryServerInterceptor records the gRPC counterparts of the HTTP request
+// metrics for every unary call: a count by full method name and status code,
+// and the call duration.
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	grpcRequestsTotal.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	grpcRequestDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+	return resp, err
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// OtherValue is the value of a header label beyond the cap set with
+// WithHeaderLabels.
+const OtherValue = "other"
+
+// maxHeaderValue is the length header label values are cut to.
+const maxHeaderValue = 64
+
+// HeaderLabel names the label taking the value of a request header.
+type HeaderLabel struct {
+	// Name is the label name, e.g. client_version.
+	Name string
+	// Header is the request header, e.g. X-Client-Version.
+	Header string
+}
+
+// Label is a label of a request and its value.
+type Label struct {
+	Name, Value string
+}
+
+// WithHeaderLabels adds labels to the request count, duration and time to
+// first byte with the values of request headers, e.g. the tenant ID or the
+// client version, so that the load can be broken down by them. Values are
+// cut to 64 characters, with those other than letters, digits and ._-/:+
+// replaced by _; a missing header gives an empty value. Once a label has
+// max values, new ones are labelled "other", so that clients sending
+// arbitrary headers cannot blow up the number of series.
+func WithHeaderLabels(max int, labels ...HeaderLabel) Option {
+	return func(o *options) {
+		o.headerLabels = append(o.headerLabels, labels...)
+		o.maxHeaderValues = max
+	}
+}
+
+// headerLabels extracts the header labels of requests.
+type headerLabels struct {
+	labels []HeaderLabel
+	values []*valueSet
+}
+
+func newHeaderLabels(labels []HeaderLabel, max int) *headerLabels {
+	h := &headerLabels{labels: labels}
+	for range labels {
+		h.values = append(h.values, &valueSet{max: max, seen: make(map[string]bool)})
+	}
+	return h
+}
+
+// of returns the header labels of r, in the order they were configured.
+func (h *headerLabels) of(r *http.Request) []Label {
+	out := make([]Label, len(h.labels))
+	for i, l := range h.labels {
+		out[i] = Label{Name: l.Name, Value: h.values[i].label(sanitizeLabel(r.Header.Get(l.Header)))}
+	}
+	return out
+}
+
+// valueSet caps the distinct values of a label.
+type valueSet struct {
+	max  int
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// label returns v, or OtherValue if v is new and the set is full. The
+// empty value is always allowed.
+func (s *valueSet) label(v string) string {
+	if v == "" {
+		return v
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen[v] {
+		return v
+	}
+	if len(s.seen) >= s.max {
+		return OtherValue
+	}
+	s.seen[v] = true
+	return v
+}
+
+// sanitizeLabel cuts a header value to maxHeaderValue characters and
+// replaces those outside a safe set with _.
+func sanitizeLabel(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) > maxHeaderValue {
+		v = v[:maxHeaderValue]
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("._-/:+", r):
+			return r
+		}
+		return '_'
+	}, v)
+}
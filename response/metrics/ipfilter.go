@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Decisões das listas de IPs permitidos e bloqueados, pela regra (CIDR) que
+// decidiu ou "default" quando nenhuma regra casou.
+var ipFilterDecisionsTotal = shared.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "go_server_ip_filter_decisions_total",
+		Help: "Total de requisições permitidas ou bloqueadas pelas listas de IPs.",
+	},
+	[]string{"decision", "rule"},
+)
+
+// IPFilterDecision counts a request that the IP lists allowed (or not)
+// because of rule.
+func IPFilterDecision(allowed bool, rule string) {
+	decision := "denied"
+	if allowed {
+		decision = "allowed"
+	}
+	ipFilterDecisionsTotal.WithLabelValues(decision, rule).Inc()
+}
@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Goroutines e conexões vazadas de propósito pelo modo de vazamento, por
+// tipo (goroutine, connection).
+var leaked = shared.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "go_server_leaked",
+		Help: "Goroutines e conexões vazadas de propósito e ainda não liberadas.",
+	},
+	[]string{"kind"},
+)
+
+// Leaked records one more deliberately leaked resource of the given kind.
+func Leaked(kind string) {
+	leaked.WithLabelValues(kind).Inc()
+}
+
+// LeaksReleased records that every leaked resource was released.
+func LeaksReleased() {
+	leaked.Reset()
+}
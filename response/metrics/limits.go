@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Requisições rejeitadas pelo rate limiter.
+	httpThrottledTotal = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_http_throttled_requests_total",
+			Help: "Total de requisições HTTP rejeitadas com 429 pelo rate limiter.",
+		},
+		[]string{"limit"}, // global ou client
+	)
+
+	// Requisições aguardando vaga no limitador de concorrência.
+	concurrencyQueueDepth = shared.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "go_server_http_queue_depth",
+			Help: "Número de requisições aguardando na fila do limitador de concorrência.",
+		},
+	)
+
+	// Requisições descartadas (load shedding) com 503.
+	httpShedTotal = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_http_shed_requests_total",
+			Help: "Total de requisições HTTP descartadas com 503 pelo limitador de concorrência.",
+		},
+		[]string{"reason"}, // queue_full, queue_timeout, deadline ou canceled
+	)
+
+	// Requisições que estouraram o prazo de -request-timeout.
+	httpRequestTimeoutsTotal = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_http_request_timeouts_total",
+			Help: "Total de requisições HTTP que excederam o prazo máximo do servidor.",
+		},
+		[]string{"phase"}, // before_response (503 enviado) ou during_response (resposta truncada)
+	)
+)
+
+// Throttled counts a request rejected by the rate limiter named limit
+// ("global" or "client").
+func Throttled(limit string) {
+	httpThrottledTotal.WithLabelValues(limit).Inc()
+}
+
+// SetQueueDepth reports the number of requests waiting for a concurrency slot.
+func SetQueueDepth(n int) {
+	concurrencyQueueDepth.Set(float64(n))
+}
+
+// Shed counts a request rejected by the concurrency limiter for reason
+// ("queue_full", "queue_timeout", "deadline" or "canceled").
+func Shed(reason string) {
+	httpShedTotal.WithLabelValues(reason).Inc()
+}
+
+// RequestTimeout counts a request that ran past its deadline, in phase
+// "before_response" (it was answered with 503) or "during_response" (its
+// response was cut short).
+func RequestTimeout(phase string) {
+	httpRequestTimeoutsTotal.WithLabelValues(phase).Inc()
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultListener is the listener label of requests to the main listener.
+const DefaultListener = "main"
+
+type listenerKey struct{}
+
+// WithListener labels the requests handled by next as coming from the named
+// listener, in the request metrics and access logs.
+func WithListener(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), listenerKey{}, name)))
+	})
+}
+
+// listenerLabel returns the listener set by WithListener, or DefaultListener.
+func listenerLabel(r *http.Request) string {
+	if name, ok := r.Context().Value(listenerKey{}).(string); ok {
+		return name
+	}
+	return DefaultListener
+}
+
+// ListenerAndTenant returns the listener and tenant of r, as set by
+// WithListener and WithTenant.
+func ListenerAndTenant(r *http.Request) (listener, tenant string) {
+	return listenerLabel(r), tenantLabel(r)
+}
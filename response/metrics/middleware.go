@@ -1,66 +1,357 @@
 package metrics
 
 import (
-	"log"
+	"bufio"
+	"io"
+	"net"
 	"net/http"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-var (
-	// 1. Contador de Requisições
-	httpRequestsTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "go_server_http_requests_total",
-			Help: "Total de requisições HTTP recebidas.",
-		},
-		[]string{"handler", "method", "code"}, // Labels
-	)
-
-	// 2. Histograma de Duração das Requisições
-	httpRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name: "go_server_http_request_duration_seconds",
-			Help: "Duração (latência) das requisições HTTP em segundos.",
-			// Buckets (faixas) para o histograma. Pode ajustar conforme necessário.
-			Buckets: prometheus.DefBuckets, 
-		},
-		[]string{"handler", "method"}, // Labels
-	)
-)
+// Option configures Metrics.
+type Option func(*options)
+
+type options struct {
+	buckets     []float64
+	prefix      string
+	constLabels prometheus.Labels
+	// nativeFactor is the growth factor between native histogram buckets;
+	// 0 disables native histograms.
+	nativeFactor float64
+	// summaryObjectives enables the request duration summary;
+	// noHistogram drops the histogram.
+	summaryObjectives map[float64]float64
+	noHistogram       bool
+	// maxRoutes caps the route label values; 0 disables the label.
+	maxRoutes int
+	// skipPaths and skipMethods are the requests left out.
+	skipPaths   []string
+	skipMethods []string
+	// headerLabels are labels taken from request headers, with at most
+	// maxHeaderValues values each.
+	headerLabels    []HeaderLabel
+	maxHeaderValues int
+	// recorder replaces the Prometheus request metrics if set.
+	recorder Recorder
+}
+
+// WithBuckets sets the upper bounds, in seconds, of the request duration
+// histogram buckets. The default, prometheus.DefBuckets, goes from 5ms to
+// 10s.
+func WithBuckets(buckets ...float64) Option {
+	return func(o *options) { o.buckets = buckets }
+}
+
+// WithPrefix replaces go_server at the start of the metric names, e.g.
+// WithPrefix("mock") exports mock_http_requests_total.
+func WithPrefix(prefix string) Option {
+	return func(o *options) { o.prefix = prefix }
+}
+
+// WithConstLabels adds labels with fixed values to every request metric,
+// e.g. the environment or the instance under test.
+func WithConstLabels(labels map[string]string) Option {
+	return func(o *options) { o.constLabels = labels }
+}
+
+// WithNativeHistogram also exports the request duration histogram as a
+// Prometheus native histogram, whose buckets grow by at most factor (e.g.
+// 1.1 for 10%), giving high resolution latencies at a small cost. The
+// classic buckets are kept for scrapers without native histogram support.
+func WithNativeHistogram(factor float64) Option {
+	return func(o *options) { o.nativeFactor = factor }
+}
+
+// WithSummary also exports the request duration as a summary with the
+// quantiles of objectives, each with its allowed error, e.g. {0.5: 0.05,
+// 0.9: 0.01, 0.99: 0.001}, over the last 10 minutes. It is named
+// _http_request_duration_summary_seconds, or _http_request_duration_seconds
+// with WithoutHistogram. Unlike histogram buckets, quantiles cannot be
+// aggregated across instances or handlers.
+func WithSummary(objectives map[float64]float64) Option {
+	return func(o *options) { o.summaryObjectives = objectives }
+}
+
+// WithoutHistogram leaves out the request duration histogram, for
+// dashboards that only use the quantiles of WithSummary.
+func WithoutHistogram() Option {
+	return func(o *options) { o.noHistogram = true }
+}
+
+// WithSkipPaths leaves the requests for paths out of the metrics and the
+// access log, e.g. health checks and /favicon.ico. A path ending in / also
+// covers the paths below it.
+func WithSkipPaths(paths ...string) Option {
+	return func(o *options) { o.skipPaths = append(o.skipPaths, paths...) }
+}
+
+// WithSkipMethods leaves the requests with the given methods, e.g. OPTIONS
+// or HEAD, out of the metrics and the access log.
+func WithSkipMethods(methods ...string) Option {
+	return func(o *options) { o.skipMethods = append(o.skipMethods, methods...) }
+}
+
+// Metrics are the request metrics of a server: the count and the duration of
+// the requests served by the handlers wrapped with Handler, which also
+// writes their access log.
+type Metrics struct {
+	rec Recorder
+	// routes is nil without the route label.
+	routes *routeSet
+	// headers is nil without header labels.
+	headers *headerLabels
+	// skipPaths and skipMethods are set by WithSkipPaths and
+	// WithSkipMethods.
+	skipPaths   []string
+	skipMethods map[string]bool
+}
+
+// NewMetrics creates the request metrics configured by opts and registers
+// them with reg, along with the process-wide metrics of the server's
+// features. A server given its own registry, e.g. prometheus.NewRegistry(),
+// has request metrics of its own; metrics already registered with reg under
+// the same names and labels are shared instead, keeping the buckets they
+// were created with.
+func NewMetrics(reg prometheus.Registerer, opts ...Option) (*Metrics, error) {
+	o := options{buckets: prometheus.DefBuckets, prefix: "go_server"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	m := &Metrics{rec: o.recorder}
+	if m.rec == nil {
+		rec, err := newPromRecorder(reg, o)
+		if err != nil {
+			return nil, err
+		}
+		m.rec = rec
+	}
+	if o.maxRoutes > 0 {
+		m.routes = newRouteSet(o.maxRoutes)
+	}
+	if len(o.headerLabels) > 0 {
+		m.headers = newHeaderLabels(o.headerLabels, o.maxHeaderValues)
+	}
+	m.skipPaths = o.skipPaths
+	m.skipMethods = make(map[string]bool)
+	for _, method := range o.skipMethods {
+		m.skipMethods[strings.ToUpper(method)] = true
+	}
+	for _, c := range sharedCollectors {
+		if _, err := register(reg, c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// defaultMetrics are the Metrics of PrometheusMiddleware.
+var defaultMetrics = sync.OnceValue(func() *Metrics {
+	m, err := NewMetrics(prometheus.DefaultRegisterer)
+	if err != nil {
+		panic(err)
+	}
+	return m
+})
 
 // --- Middleware (Definido no Passo 3) ---
 type statusResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
+	// firstByte is when the handler started the response.
+	firstByte time.Time
 }
 
 func newStatusResponseWriter(w http.ResponseWriter) *statusResponseWriter {
-	return &statusResponseWriter{w, http.StatusOK}
+	return &statusResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 }
 
 func (srw *statusResponseWriter) WriteHeader(code int) {
+	srw.started()
 	srw.statusCode = code
 	srw.ResponseWriter.WriteHeader(code)
 }
 
+func (srw *statusResponseWriter) Write(b []byte) (int, error) {
+	srw.started()
+	n, err := srw.ResponseWriter.Write(b)
+	srw.bytes += int64(n)
+	return n, err
+}
+
+// started notes the time of the first byte of the response.
+func (srw *statusResponseWriter) started() {
+	if srw.firstByte.IsZero() {
+		srw.firstByte = time.Now()
+	}
+}
+
+// ReadFrom counts the bytes of the response while keeping the sendfile
+// path of the underlying writer, used by http.ServeContent and io.Copy.
+func (srw *statusResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	srw.started()
+	var n int64
+	var err error
+	if rf, ok := srw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{srw.ResponseWriter}, src)
+	}
+	srw.bytes += n
+	return n, err
+}
+
+// writerOnly hides the ReadFrom method of a writer from io.Copy.
+type writerOnly struct {
+	io.Writer
+}
+
+// Flush lets streaming handlers push partial responses through the
+// middleware.
+func (srw *statusResponseWriter) Flush() {
+	http.NewResponseController(srw.ResponseWriter).Flush()
+}
+
+// Hijack lets handlers take over the connection, e.g. for WebSocket
+// upgrades, with libraries that look for http.Hijacker rather than using
+// http.ResponseController.
+func (srw *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(srw.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (srw *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return srw.ResponseWriter
+}
+
+// PrometheusMiddleware wraps next in the request metrics of the default
+// registerer, with the default options, labelling its requests with
+// handlerLabel.
 func PrometheusMiddleware(next http.Handler, handlerLabel string) http.Handler {
+	return defaultMetrics().Handler(next, handlerLabel)
+}
+
+// Middleware returns the Handler wrapping of the requests labelled
+// handlerLabel, for middleware chains.
+func (m *Metrics) Middleware(handlerLabel string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return m.Handler(next, handlerLabel)
+	}
+}
+
+// Handler wraps next, labelling its requests with handlerLabel.
+func (m *Metrics) Handler(next http.Handler, handlerLabel string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+		countConnRequest(r.Context())
+		if m.skip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m.rec.RequestStarted(r.Context(), handlerLabel)
+		varInFlight.Add(1)
 		startTime := time.Now()
 		srw := newStatusResponseWriter(w)
+		body := &countingBody{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
 
+		defer func() {
+			// A panic is counted as the 500 the server's recovery answers
+			// with, and goes on up to it.
+			if p := recover(); p != nil {
+				panicked := p != http.ErrAbortHandler
+				if panicked && srw.firstByte.IsZero() {
+					srw.statusCode = http.StatusInternalServerError
+				}
+				m.record(r, handlerLabel, srw, body, startTime, panicked)
+				panic(p)
+			}
+		}()
 		next.ServeHTTP(srw, r)
+		m.record(r, handlerLabel, srw, body, startTime, false)
+	})
+}
 
-		duration := time.Since(startTime)
-		log.Printf("Request handled: Method=%s, Path=%s, Latency=%s", r.Method, r.URL.Path, duration)
-		method := r.Method
-		code := strconv.Itoa(srw.statusCode)
+// record writes the access log and the metrics of a finished request.
+func (m *Metrics) record(r *http.Request, handlerLabel string, srw *statusResponseWriter, body *countingBody, startTime time.Time, panicked bool) {
+	duration := time.Since(startTime)
+	proto := ProtoLabel(r)
+	logAccess(r, handlerLabel, proto, srw, duration)
 
-		httpRequestsTotal.WithLabelValues(handlerLabel, method, code).Inc()
-		httpRequestDuration.WithLabelValues(handlerLabel, method).Observe(duration.Seconds())
-	})
+	req := Request{
+		Handler:         handlerLabel,
+		Method:          r.Method,
+		Status:          srw.statusCode,
+		Proto:           proto,
+		Listener:        listenerLabel(r),
+		Tenant:          tenantLabel(r),
+		TestID:          r.Header.Get("X-Mgc-Test-Id"),
+		Duration:        duration,
+		TimeToFirstByte: duration,
+		RequestBytes:    body.n,
+		ResponseBytes:   srw.bytes,
+		Panicked:        panicked,
+	}
+	if m.routes != nil {
+		req.Route = m.routes.label(r.Pattern, r.URL.Path)
+	}
+	if m.headers != nil {
+		req.Labels = m.headers.of(r)
+	}
+	// A handler that writes nothing gets its response sent when it
+	// returns.
+	if !srw.firstByte.IsZero() {
+		req.TimeToFirstByte = srw.firstByte.Sub(startTime)
+	}
+	m.rec.RequestFinished(r.Context(), req)
+
+	varInFlight.Add(-1)
+	varRequests.Add(1)
+	if req.Status >= 500 {
+		varErrors.Add(1)
+	}
+}
+
+// skip reports whether r is left out of the metrics and the access log.
+func (m *Metrics) skip(r *http.Request) bool {
+	if m.skipMethods[r.Method] {
+		return true
+	}
+	for _, p := range m.skipPaths {
+		if r.URL.Path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(r.URL.Path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// ProtoLabel returns the negotiated protocol of r as used in metric labels:
+// HTTP/1.0, HTTP/1.1, HTTP/2 or HTTP/3.
+func ProtoLabel(r *http.Request) string {
+	switch r.ProtoMajor {
+	case 2:
+		return "HTTP/2"
+	case 3:
+		return "HTTP/3"
+	default:
+		return r.Proto
+	}
 }
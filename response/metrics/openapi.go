@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Requisições rejeitadas por não seguirem a especificação OpenAPI, por
+// operação e motivo (path, method, parameter, body ou security).
+var openAPIFailuresTotal = shared.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "go_server_openapi_validation_failures_total",
+		Help: "Total de requisições rejeitadas por não seguirem a especificação OpenAPI.",
+	},
+	[]string{"operation", "reason"},
+)
+
+// OpenAPIFailure counts a request to operation (e.g. "GET /pets/{id}", or
+// "unknown" when no operation matched) rejected for reason.
+func OpenAPIFailure(operation, reason string) {
+	openAPIFailuresTotal.WithLabelValues(operation, reason).Inc()
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// otelRecorder records the request metrics as OpenTelemetry instruments
+// named after the HTTP semantic conventions.
+type otelRecorder struct {
+	duration     metric.Float64Histogram
+	active       metric.Int64UpDownCounter
+	requestSize  metric.Int64Histogram
+	responseSize metric.Int64Histogram
+	firstByte    metric.Float64Histogram
+	panics       metric.Int64Counter
+}
+
+// NewOTelRecorder creates a Recorder that records the request metrics with
+// the meters of mp, e.g. an OTLP exporter of the OpenTelemetry SDK:
+// http.server.request.duration, http.server.active_requests,
+// http.server.request.body.size and http.server.response.body.size, plus
+// http.server.time_to_first_byte and http.server.panics.
+func NewOTelRecorder(mp metric.MeterProvider) (Recorder, error) {
+	meter := mp.Meter("server/metrics")
+	o := &otelRecorder{}
+	var err error
+	// Faixas das convenções semânticas para a duração, em segundos.
+	durationBuckets := metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10)
+	if o.duration, err = meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duração das requisições HTTP."),
+		metric.WithUnit("s"), durationBuckets); err != nil {
+		return nil, err
+	}
+	if o.active, err = meter.Int64UpDownCounter("http.server.active_requests",
+		metric.WithDescription("Requisições HTTP em andamento."),
+		metric.WithUnit("{request}")); err != nil {
+		return nil, err
+	}
+	if o.requestSize, err = meter.Int64Histogram("http.server.request.body.size",
+		metric.WithDescription("Tamanho dos corpos de requisição lidos pelos handlers."),
+		metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	if o.responseSize, err = meter.Int64Histogram("http.server.response.body.size",
+		metric.WithDescription("Tamanho dos corpos de resposta escritos pelos handlers."),
+		metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	if o.firstByte, err = meter.Float64Histogram("http.server.time_to_first_byte",
+		metric.WithDescription("Tempo até o handler iniciar a resposta."),
+		metric.WithUnit("s"), durationBuckets); err != nil {
+		return nil, err
+	}
+	if o.panics, err = meter.Int64Counter("http.server.panics",
+		metric.WithDescription("Pânicos dos handlers HTTP."),
+		metric.WithUnit("{panic}")); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *otelRecorder) RequestStarted(ctx context.Context, handler string) {
+	o.active.Add(ctx, 1, metric.WithAttributes(attribute.String("handler", handler)))
+}
+
+func (o *otelRecorder) RequestFinished(ctx context.Context, req Request) {
+	handler := metric.WithAttributes(attribute.String("handler", req.Handler))
+	o.active.Add(ctx, -1, handler)
+	if req.Panicked {
+		o.panics.Add(ctx, 1, handler)
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("handler", req.Handler),
+		attribute.String("http.request.method", req.Method),
+		attribute.Int("http.response.status_code", req.Status),
+		attribute.String("network.protocol.version", strings.TrimPrefix(req.Proto, "HTTP/")),
+		attribute.String("listener", req.Listener),
+		attribute.String("tenant", req.Tenant),
+	}
+	if req.Route != "" {
+		attrs = append(attrs, attribute.String("http.route", req.Route))
+	}
+	for _, l := range req.Labels {
+		attrs = append(attrs, attribute.String(l.Name, l.Value))
+	}
+	// Os exemplares vêm do span em ctx, se houver.
+	set := metric.WithAttributeSet(attribute.NewSet(attrs...))
+	o.duration.Record(ctx, req.Duration.Seconds(), set)
+	o.firstByte.Record(ctx, req.TimeToFirstByte.Seconds(), set)
+	o.requestSize.Record(ctx, req.RequestBytes, set)
+	o.responseSize.Record(ctx, req.ResponseBytes, set)
+}
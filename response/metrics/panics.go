@@ -0,0 +1,20 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Pânicos de handlers recuperados pelo middleware.
+	httpPanicsTotal = shared.NewCounter(
+		prometheus.CounterOpts{
+			Name: "go_server_http_panics_total",
+			Help: "Total de pânicos em handlers HTTP recuperados pelo servidor.",
+		},
+	)
+)
+
+// Panicked counts a handler panic recovered by the server.
+func Panicked() {
+	httpPanicsTotal.Inc()
+}
@@ -0,0 +1,277 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// promRecorder is the default Recorder: the request metrics are Prometheus
+// collectors, served with the rest on /metrics.
+type promRecorder struct {
+	requests *prometheus.CounterVec
+	// duration and summary are nil unless enabled.
+	duration     *prometheus.HistogramVec
+	summary      *prometheus.SummaryVec
+	requestSize  *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+	inFlight     *prometheus.GaugeVec
+	firstByte    *prometheus.HistogramVec
+	classes      *prometheus.CounterVec
+	panics       *prometheus.CounterVec
+	// routes is set if the metrics have a route label.
+	routes bool
+}
+
+// newPromRecorder creates the request metrics configured by o and registers
+// them with reg.
+func newPromRecorder(reg prometheus.Registerer, o options) (*promRecorder, error) {
+	// Labels
+	requestLabels := []string{"handler", "method", "code", "proto", "listener", "tenant"}
+	durationLabels := []string{"handler", "method", "proto", "listener", "tenant"}
+	if o.maxRoutes > 0 {
+		requestLabels = append(requestLabels, "route")
+		durationLabels = append(durationLabels, "route")
+	}
+	for _, l := range o.headerLabels {
+		requestLabels = append(requestLabels, l.Name)
+		durationLabels = append(durationLabels, l.Name)
+	}
+
+	p := &promRecorder{
+		routes: o.maxRoutes > 0,
+
+		// 1. Contador de Requisições
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        o.prefix + "_http_requests_total",
+				Help:        "Total de requisições HTTP recebidas.",
+				ConstLabels: o.constLabels,
+			},
+			requestLabels,
+		),
+
+		// 2. Histograma de Duração das Requisições
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:        o.prefix + "_http_request_duration_seconds",
+				Help:        "Duração (latência) das requisições HTTP em segundos.",
+				ConstLabels: o.constLabels,
+				// Buckets (faixas) para o histograma, em segundos.
+				Buckets: o.buckets,
+				// Histograma nativo (esparso), se habilitado: o número de
+				// faixas é limitado e reduzido se crescer demais.
+				NativeHistogramBucketFactor:     o.nativeFactor,
+				NativeHistogramMaxBucketNumber:  nativeMaxBuckets(o.nativeFactor),
+				NativeHistogramMinResetDuration: time.Hour,
+			},
+			durationLabels,
+		),
+
+		// 3. Tamanho dos corpos de requisição e de resposta
+		requestSize: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:        o.prefix + "_http_request_size_bytes",
+				Help:        "Tamanho em bytes dos corpos de requisição lidos pelos handlers.",
+				ConstLabels: o.constLabels,
+				Buckets:     sizeBuckets,
+			},
+			[]string{"handler", "method"},
+		),
+		responseSize: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:        o.prefix + "_http_response_size_bytes",
+				Help:        "Tamanho em bytes dos corpos de resposta escritos pelos handlers.",
+				ConstLabels: o.constLabels,
+				Buckets:     sizeBuckets,
+			},
+			[]string{"handler", "method"},
+		),
+
+		// 4. Requisições em andamento
+		inFlight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        o.prefix + "_http_requests_in_flight",
+				Help:        "Número de requisições HTTP sendo atendidas no momento.",
+				ConstLabels: o.constLabels,
+			},
+			[]string{"handler"},
+		),
+
+		// 5. Tempo até o primeiro byte da resposta
+		firstByte: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:                            o.prefix + "_http_time_to_first_byte_seconds",
+				Help:                            "Tempo em segundos do recebimento da requisição até o início da resposta.",
+				ConstLabels:                     o.constLabels,
+				Buckets:                         o.buckets,
+				NativeHistogramBucketFactor:     o.nativeFactor,
+				NativeHistogramMaxBucketNumber:  nativeMaxBuckets(o.nativeFactor),
+				NativeHistogramMinResetDuration: time.Hour,
+			},
+			durationLabels,
+		),
+
+		// 6. Requisições por classe de status, para simplificar alertas
+		classes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        o.prefix + "_http_requests_by_class_total",
+				Help:        "Total de requisições HTTP por classe de status (2xx, 3xx, 4xx, 5xx).",
+				ConstLabels: o.constLabels,
+			},
+			[]string{"handler", "class"},
+		),
+
+		// 7. Pânicos por handler
+		panics: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        o.prefix + "_http_handler_panics_total",
+				Help:        "Total de pânicos nos handlers HTTP.",
+				ConstLabels: o.constLabels,
+			},
+			[]string{"handler"},
+		),
+	}
+	var err error
+	if p.requests, err = register(reg, p.requests); err != nil {
+		return nil, err
+	}
+	if o.noHistogram {
+		if o.summaryObjectives == nil {
+			return nil, errors.New("metrics: WithoutHistogram needs WithSummary")
+		}
+		p.duration = nil
+	} else if p.duration, err = register(reg, p.duration); err != nil {
+		return nil, err
+	}
+	if o.summaryObjectives != nil {
+		name := o.prefix + "_http_request_duration_summary_seconds"
+		if o.noHistogram {
+			name = o.prefix + "_http_request_duration_seconds"
+		}
+		// 8. Resumo (quantis) da duração das requisições
+		summary := prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Name:        name,
+				Help:        "Quantis da duração (latência) das requisições HTTP em segundos.",
+				ConstLabels: o.constLabels,
+				Objectives:  o.summaryObjectives,
+				MaxAge:      10 * time.Minute,
+			},
+			durationLabels,
+		)
+		if p.summary, err = register(reg, summary); err != nil {
+			return nil, err
+		}
+	}
+	if p.requestSize, err = register(reg, p.requestSize); err != nil {
+		return nil, err
+	}
+	if p.responseSize, err = register(reg, p.responseSize); err != nil {
+		return nil, err
+	}
+	if p.inFlight, err = register(reg, p.inFlight); err != nil {
+		return nil, err
+	}
+	if p.firstByte, err = register(reg, p.firstByte); err != nil {
+		return nil, err
+	}
+	if p.classes, err = register(reg, p.classes); err != nil {
+		return nil, err
+	}
+	if p.panics, err = register(reg, p.panics); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// sizeBuckets go from 100 bytes to 100MB, by factors of 10.
+var sizeBuckets = prometheus.ExponentialBuckets(100, 10, 7)
+
+// nativeMaxBuckets caps the buckets of a native histogram, if enabled.
+func nativeMaxBuckets(factor float64) uint32 {
+	if factor <= 1 {
+		return 0
+	}
+	return 160
+}
+
+func (p *promRecorder) RequestStarted(ctx context.Context, handler string) {
+	p.inFlight.WithLabelValues(handler).Inc()
+}
+
+func (p *promRecorder) RequestFinished(ctx context.Context, req Request) {
+	p.inFlight.WithLabelValues(req.Handler).Dec()
+	if req.Panicked {
+		p.panics.WithLabelValues(req.Handler).Inc()
+	}
+
+	requestValues := []string{req.Handler, req.Method, strconv.Itoa(req.Status), req.Proto, req.Listener, req.Tenant}
+	durationValues := []string{req.Handler, req.Method, req.Proto, req.Listener, req.Tenant}
+	if p.routes {
+		requestValues = append(requestValues, req.Route)
+		durationValues = append(durationValues, req.Route)
+	}
+	for _, l := range req.Labels {
+		requestValues = append(requestValues, l.Value)
+		durationValues = append(durationValues, l.Value)
+	}
+	requests := p.requests.WithLabelValues(requestValues...)
+	ex := exemplar(ctx, req.TestID)
+	if ex != nil {
+		requests.(prometheus.ExemplarAdder).AddWithExemplar(1, ex)
+	} else {
+		requests.Inc()
+	}
+	if p.duration != nil {
+		observer := p.duration.WithLabelValues(durationValues...)
+		if ex != nil {
+			observer.(prometheus.ExemplarObserver).ObserveWithExemplar(req.Duration.Seconds(), ex)
+		} else {
+			observer.Observe(req.Duration.Seconds())
+		}
+	}
+	if p.summary != nil {
+		p.summary.WithLabelValues(durationValues...).Observe(req.Duration.Seconds())
+	}
+	p.firstByte.WithLabelValues(durationValues...).Observe(req.TimeToFirstByte.Seconds())
+	p.requestSize.WithLabelValues(req.Handler, req.Method).Observe(float64(req.RequestBytes))
+	p.responseSize.WithLabelValues(req.Handler, req.Method).Observe(float64(req.ResponseBytes))
+	p.classes.WithLabelValues(req.Handler, statusClass(req.Status)).Inc()
+}
+
+// statusClass returns the class of an HTTP status code: 1xx, 2xx, 3xx, 4xx
+// or 5xx.
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// exemplar returns the labels of the exemplar linking the metrics of a
+// request to it: the ID of its sampled trace, from ctx, or else its test ID,
+// if valid UTF-8. It returns nil if the request has neither.
+func exemplar(ctx context.Context, testID string) prometheus.Labels {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsSampled() {
+		return prometheus.Labels{"trace_id": sc.TraceID().String()}
+	}
+	// Um ID que não é UTF-8 válido faria o exemplar entrar em pânico.
+	if id := testID; id != "" && utf8.ValidString(id) {
+		// Os rótulos de um exemplar não podem passar de 128 caracteres.
+		if utf8.RuneCountInString(id) > maxExemplarValue {
+			id = string([]rune(id)[:maxExemplarValue])
+		}
+		return prometheus.Labels{"test_id": id}
+	}
+	return nil
+}
+
+// maxExemplarValue keeps test_id exemplars within the 128 runes Prometheus
+// allows for the names and values of an exemplar's labels.
+const maxExemplarValue = prometheus.ExemplarMaxRunes - len("test_id")
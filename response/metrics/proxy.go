@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Duração das requisições feitas aos upstreams no modo proxy, por upstream
+// e código de resposta ("error" quando não houve resposta).
+var upstreamRequestDuration = shared.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "go_server_upstream_request_duration_seconds",
+		Help:    "Duração (latência) das requisições enviadas aos upstreams em segundos.",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"upstream", "method", "code"},
+)
+
+// UpstreamRequest records a request sent to upstream that got status after
+// elapsed. A status of 0 means the request failed without a response.
+func UpstreamRequest(upstream, method string, status int, elapsed time.Duration) {
+	code := "error"
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+	upstreamRequestDuration.WithLabelValues(upstream, method, code).Observe(elapsed.Seconds())
+}
+
+// Requisições não espelhadas porque o upstream sombra tinha requisições
+// pendentes demais.
+var mirrorDroppedTotal = shared.NewCounter(
+	prometheus.CounterOpts{
+		Name: "go_server_mirror_dropped_total",
+		Help: "Total de requisições que não foram espelhadas por excesso de requisições pendentes no upstream sombra.",
+	},
+)
+
+// MirrorDropped counts a request that was not mirrored because too many
+// mirrored requests were still in flight.
+func MirrorDropped() {
+	mirrorDroppedTotal.Inc()
+}
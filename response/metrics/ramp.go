@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rampExtra returns the latency added by the current latency ramp, or is nil
+// without one.
+var rampExtra atomic.Pointer[func() time.Duration]
+
+// Latência extra adicionada pela rampa neste momento.
+var _ = shared.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Name: "go_server_latency_ramp_seconds",
+		Help: "Latência extra em segundos adicionada pela rampa de latência neste momento.",
+	},
+	func() float64 {
+		if extra := rampExtra.Load(); extra != nil {
+			return (*extra)().Seconds()
+		}
+		return 0
+	},
+)
+
+// LatencyRamp reports the latency currently added by the latency ramp,
+// as returned by extra, in the go_server_latency_ramp_seconds gauge. A later
+// call replaces the ramp reported.
+func LatencyRamp(extra func() time.Duration) {
+	rampExtra.Store(&extra)
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"time"
+)
+
+// Recorder sends the request metrics of Metrics.Handler to a metrics
+// backend. The default one exports Prometheus metrics; NewOTelRecorder and
+// NewStatsdRecorder create others, set with WithRecorder. Its methods are
+// called concurrently.
+type Recorder interface {
+	// RequestStarted is called when a request for handler comes in.
+	RequestStarted(ctx context.Context, handler string)
+	// RequestFinished is called once the request is served, even if its
+	// handler panicked. ctx carries the request's trace, if any.
+	RequestFinished(ctx context.Context, req Request)
+}
+
+// Request describes a finished request.
+type Request struct {
+	Handler  string
+	Method   string
+	Status   int
+	Proto    string
+	Listener string
+	Tenant   string
+	// Route is the route label set with WithRoutes, or empty.
+	Route string
+	// Labels are the header labels set with WithHeaderLabels.
+	Labels []Label
+	// TestID is the X-Mgc-Test-Id of the request, or empty.
+	TestID string
+
+	Duration time.Duration
+	// TimeToFirstByte is how long the handler took to start the response.
+	TimeToFirstByte time.Duration
+	// RequestBytes and ResponseBytes count the bytes of the bodies read and
+	// written by the handler.
+	RequestBytes  int64
+	ResponseBytes int64
+	// Panicked is set if the handler panicked.
+	Panicked bool
+}
+
+// WithRecorder sends the request metrics to rec instead of exporting them as
+// Prometheus metrics. The process-wide metrics of the server's features are
+// still registered with the registry given to NewMetrics.
+func WithRecorder(rec Recorder) Option {
+	return func(o *options) { o.recorder = rec }
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// shared creates the metrics of the server's features (connections, limits,
+// caches and so on). They count for the whole process: like promauto, they
+// are registered with the default registerer, and NewMetrics registers them
+// with its registry as well.
+var shared = promauto.With(sharedRegisterer{})
+
+// sharedCollectors are the collectors created by shared.
+var sharedCollectors []prometheus.Collector
+
+type sharedRegisterer struct{}
+
+func (sharedRegisterer) Register(c prometheus.Collector) error {
+	sharedCollectors = append(sharedCollectors, c)
+	return prometheus.DefaultRegisterer.Register(c)
+}
+
+func (r sharedRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (sharedRegisterer) Unregister(c prometheus.Collector) bool {
+	return prometheus.DefaultRegisterer.Unregister(c)
+}
+
+// register registers c with reg, or returns the collector already
+// registered in its place.
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	err := reg.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(C); ok {
+			return existing, nil
+		}
+	}
+	return c, err
+}
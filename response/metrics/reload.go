@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Recargas do arquivo de configuração, por resultado (success ou
+	// failure).
+	configReloadsTotal = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_config_reloads_total",
+			Help: "Total de recargas do arquivo de configuração, por resultado.",
+		},
+		[]string{"result"},
+	)
+
+	// Momento da última recarga bem-sucedida.
+	configLastReload = shared.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "go_server_config_last_reload_success_timestamp_seconds",
+			Help: "Momento (Unix) da última recarga bem-sucedida do arquivo de configuração.",
+		},
+	)
+)
+
+// ConfigReload counts a reload of the configuration file that succeeded or
+// failed.
+func ConfigReload(ok bool) {
+	if !ok {
+		configReloadsTotal.WithLabelValues("failure").Inc()
+		return
+	}
+	configReloadsTotal.WithLabelValues("success").Inc()
+	configLastReload.SetToCurrentTime()
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// OtherRoute is the route label of the requests beyond the cap set with
+// WithRoutes.
+const OtherRoute = "other"
+
+// WithRoutes adds a route label to the request count, duration and time to
+// first byte: the ServeMux pattern that matched the request, e.g.
+// /users/{id}, or for catch-all patterns such as / the path with its IDs
+// (numbers, UUIDs and long hex strings) replaced by {id}. Once max routes
+// have been seen, new ones are labelled "other", so that clients requesting
+// arbitrary paths cannot blow up the number of series.
+func WithRoutes(max int) Option {
+	return func(o *options) { o.maxRoutes = max }
+}
+
+// routeSet caps the distinct route labels.
+type routeSet struct {
+	max  int
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newRouteSet(max int) *routeSet {
+	return &routeSet{max: max, seen: make(map[string]bool)}
+}
+
+// label returns the route label of a request for pattern and path.
+func (s *routeSet) label(pattern, path string) string {
+	// O padrão pode trazer o método ("GET /users/{id}").
+	if _, p, ok := strings.Cut(pattern, " "); ok {
+		pattern = p
+	}
+	route := pattern
+	if pattern == "" || strings.HasSuffix(pattern, "/") {
+		route = normalizePath(path)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen[route] {
+		return route
+	}
+	if len(s.seen) >= s.max {
+		return OtherRoute
+	}
+	s.seen[route] = true
+	return route
+}
+
+var idSegment = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+// normalizePath replaces the segments of path that look like IDs with {id},
+// e.g. /users/42/orders becomes /users/{id}/orders. Bytes that are not valid
+// UTF-8 become ?, since label values must be valid UTF-8.
+func normalizePath(path string) string {
+	segments := strings.Split(strings.ToValidUTF8(path, "?"), "/")
+	for i, seg := range segments {
+		if idSegment.MatchString(seg) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
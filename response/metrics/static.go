@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Requisições de arquivos estáticos, por arquivo.
+	staticRequestsTotal = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_static_file_requests_total",
+			Help: "Total de requisições de arquivos estáticos por arquivo e código de status.",
+		},
+		[]string{"file", "code"},
+	)
+
+	// Bytes enviados de arquivos estáticos, por arquivo.
+	staticBytesTotal = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_static_file_bytes_total",
+			Help: "Total de bytes de arquivos estáticos enviados por arquivo.",
+		},
+		[]string{"file"},
+	)
+)
+
+// StaticFile records a request for a static file that sent n body bytes.
+func StaticFile(file string, code int, n int64) {
+	staticRequestsTotal.WithLabelValues(file, strconv.Itoa(code)).Inc()
+	staticBytesTotal.WithLabelValues(file).Add(float64(n))
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// statsdRecorder sends the request metrics to a statsd server over UDP, with
+// DogStatsD tags.
+type statsdRecorder struct {
+	conn   net.Conn
+	prefix string
+	// tags are the constant tags, ready to follow those of a metric.
+	tags string
+}
+
+// NewStatsdRecorder creates a Recorder that sends the request metrics to the
+// statsd server at addr, e.g. 127.0.0.1:8125, with names starting with
+// prefix and the labels as DogStatsD tags along with tags. Every request is
+// one UDP packet, so a slow or missing server never holds up the requests.
+func NewStatsdRecorder(addr, prefix string, tags map[string]string) (Recorder, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString("," + statsdTag(name) + ":" + statsdTag(tags[name]))
+	}
+	return &statsdRecorder{conn: conn, prefix: prefix, tags: b.String()}, nil
+}
+
+func (s *statsdRecorder) RequestStarted(ctx context.Context, handler string) {
+	fmt.Fprintf(s.conn, "%s.http.requests_in_flight:+1|g|#handler:%s%s", s.prefix, statsdTag(handler), s.tags)
+}
+
+func (s *statsdRecorder) RequestFinished(ctx context.Context, req Request) {
+	handler := "handler:" + statsdTag(req.Handler) + s.tags
+	tags := "handler:" + statsdTag(req.Handler) +
+		",method:" + statsdTag(req.Method) +
+		",code:" + strconv.Itoa(req.Status) +
+		",class:" + statusClass(req.Status) +
+		",proto:" + statsdTag(req.Proto) +
+		",listener:" + statsdTag(req.Listener) +
+		",tenant:" + statsdTag(req.Tenant)
+	if req.Route != "" {
+		tags += ",route:" + statsdTag(req.Route)
+	}
+	for _, l := range req.Labels {
+		tags += "," + statsdTag(l.Name) + ":" + statsdTag(l.Value)
+	}
+	tags += s.tags
+
+	// Uma linha por métrica, todas no mesmo pacote.
+	var b strings.Builder
+	line := func(name, value, kind, tags string) {
+		fmt.Fprintf(&b, "%s.%s:%s|%s|#%s\n", s.prefix, name, value, kind, tags)
+	}
+	line("http.requests_in_flight", "-1", "g", handler)
+	line("http.requests", "1", "c", tags)
+	line("http.request_duration", ms(req.Duration.Seconds()), "ms", tags)
+	line("http.time_to_first_byte", ms(req.TimeToFirstByte.Seconds()), "ms", tags)
+	line("http.request_size", strconv.FormatInt(req.RequestBytes, 10), "h", handler)
+	line("http.response_size", strconv.FormatInt(req.ResponseBytes, 10), "h", handler)
+	if req.Panicked {
+		line("http.handler_panics", "1", "c", handler)
+	}
+	s.conn.Write([]byte(strings.TrimSuffix(b.String(), "\n")))
+}
+
+// ms formats seconds as milliseconds.
+func ms(seconds float64) string {
+	return strconv.FormatFloat(seconds*1000, 'f', 3, 64)
+}
+
+// statsdTag replaces the characters that delimit statsd lines and tags.
+func statsdTag(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', ',', '#', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, v)
+}
@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultTenant is the tenant label of requests that match no -tenant.
+const DefaultTenant = "default"
+
+type tenantKey struct{}
+
+// WithTenant labels the requests handled by next as belonging to the named
+// tenant, in the request metrics and access logs.
+func WithTenant(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, name)))
+	})
+}
+
+// tenantLabel returns the tenant set by WithTenant, or DefaultTenant.
+func tenantLabel(r *http.Request) string {
+	if name, ok := r.Context().Value(tenantKey{}).(string); ok {
+		return name
+	}
+	return DefaultTenant
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Handshakes TLS iniciados; a diferença para os concluídos são as falhas.
+	tlsHandshakesStarted = shared.NewCounter(
+		prometheus.CounterOpts{
+			Name: "go_server_tls_handshakes_started_total",
+			Help: "Total de handshakes TLS iniciados (ClientHello recebido).",
+		},
+	)
+
+	// Handshakes TLS concluídos, por versão, cifra e retomada de sessão.
+	tlsHandshakes = shared.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "go_server_tls_handshakes_total",
+			Help: "Total de handshakes TLS concluídos por versão, suíte de cifras e retomada de sessão.",
+		},
+		[]string{"version", "cipher", "resumed"},
+	)
+
+	// Duração dos handshakes TLS, do ClientHello até a verificação final.
+	tlsHandshakeDuration = shared.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "go_server_tls_handshake_duration_seconds",
+			Help:    "Duração dos handshakes TLS em segundos, do ClientHello à conclusão.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 12),
+		},
+		[]string{"version", "resumed"},
+	)
+)
+
+// InstrumentTLS returns a copy of cfg recording the TLS handshake metrics:
+// the handshakes started and completed, by negotiated version, cipher suite
+// and whether the session was resumed, and their duration from the
+// ClientHello on. Handshakes started but never completed are the failed
+// ones. A GetConfigForClient or VerifyConnection of cfg is still called,
+// and a cfg without NextProtos offers HTTP/2 and HTTP/1.1, as net/http
+// would.
+func InstrumentTLS(cfg *tls.Config) *tls.Config {
+	base := cfg.Clone()
+	// A configuração devolvida por GetConfigForClient substitui a que o
+	// http.Server ajusta ao iniciar, então os protocolos ALPN que ele
+	// acrescentaria vão aqui.
+	if len(base.NextProtos) == 0 {
+		base.NextProtos = []string{"h2", "http/1.1"}
+	}
+	getConfig := cfg.GetConfigForClient
+	instrumented := cfg.Clone()
+	instrumented.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		tlsHandshakesStarted.Inc()
+		start := time.Now()
+
+		conn := base
+		if getConfig != nil {
+			c, err := getConfig(hello)
+			if err != nil {
+				return nil, err
+			}
+			if c != nil {
+				conn = c
+			}
+		}
+		// Uma cópia por conexão guarda o início do handshake. As chaves
+		// dos tickets de sessão são copiadas, então a retomada continua
+		// funcionando.
+		conn = conn.Clone()
+		verify := conn.VerifyConnection
+		conn.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(cs); err != nil {
+					return err
+				}
+			}
+			version := tls.VersionName(cs.Version)
+			resumed := strconv.FormatBool(cs.DidResume)
+			tlsHandshakes.WithLabelValues(version, tls.CipherSuiteName(cs.CipherSuite), resumed).Inc()
+			tlsHandshakeDuration.WithLabelValues(version, resumed).Observe(time.Since(start).Seconds())
+			return nil
+		}
+		return conn, nil
+	}
+	return instrumented
+}
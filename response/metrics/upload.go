@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Bytes recebidos em uploads multipart.
+	uploadBytesTotal = shared.NewCounter(
+		prometheus.CounterOpts{
+			Name: "go_server_upload_bytes_total",
+			Help: "Total de bytes recebidos em partes de uploads multipart.",
+		},
+	)
+
+	// Partes recebidas em uploads multipart.
+	uploadPartsTotal = shared.NewCounter(
+		prometheus.CounterOpts{
+			Name: "go_server_upload_parts_total",
+			Help: "Total de partes recebidas em uploads multipart concluídos.",
+		},
+	)
+
+	// Vazão de cada upload concluído.
+	uploadThroughput = shared.NewHistogram(
+		prometheus.HistogramOpts{
+			Name: "go_server_upload_throughput_bytes_per_second",
+			Help: "Vazão (bytes por segundo) dos uploads multipart concluídos.",
+			// De 64KB/s a 16GB/s.
+			Buckets: prometheus.ExponentialBuckets(64<<10, 4, 10),
+		},
+	)
+)
+
+// UploadBytes counts n bytes of an uploaded part as they are received.
+func UploadBytes(n int64) {
+	uploadBytesTotal.Add(float64(n))
+}
+
+// Upload records a completed upload of parts parts and n bytes that took
+// elapsed.
+func Upload(parts int, n int64, elapsed time.Duration) {
+	uploadPartsTotal.Add(float64(parts))
+	if elapsed > 0 {
+		uploadThroughput.Observe(float64(n) / elapsed.Seconds())
+	}
+}
@@ -0,0 +1,173 @@
+package mockserver
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clfTimeFormat is the timestamp layout of the Common Log Format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// clfLog writes one line per request in the Common or Combined Log Format
+// used by Apache and nginx, for tools such as GoAccess or awstats.
+type clfLog struct {
+	out      io.Writer
+	combined bool
+}
+
+func (l *clfLog) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		l.out.Write(l.line(r, start, rec.status, rec.bytes))
+	})
+}
+
+// line formats the log line for a request, e.g.
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://example.com/" "Mozilla/4.08"
+func (l *clfLog) line(r *http.Request, start time.Time, status int, n int64) []byte {
+	user, _, _ := r.BasicAuth()
+	size := "-"
+	if n > 0 {
+		size = strconv.FormatInt(n, 10)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s - %s [%s] \"%s %s %s\" %d %s",
+		clientIP(r), clfField(user), start.Format(clfTimeFormat),
+		r.Method, clfEscape(r.RequestURI), r.Proto, status, size)
+	if l.combined {
+		fmt.Fprintf(&b, " \"%s\" \"%s\"", clfEscape(r.Referer()), clfEscape(r.UserAgent()))
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// clfField returns "-" for empty fields, as the format requires.
+func clfField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return clfEscape(s)
+}
+
+// clfEscape keeps client-supplied values from breaking the line apart.
+func clfEscape(s string) string {
+	q := strconv.Quote(s)
+	return q[1 : len(q)-1]
+}
+
+// responseRecorder captures the status and body size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// rotatingFile is an append-only log file that is renamed aside and reopened
+// once it exceeds maxSize bytes or when a rotation interval boundary passes.
+// A zero maxSize or interval disables that trigger. Rotated files get a
+// timestamp suffix, e.g. access.log.20240131T235959.000.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	interval time.Duration
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	next time.Time // when the next time-based rotation is due
+}
+
+func openRotatingFile(path string, maxSize int64, interval time.Duration) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, interval: interval}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size = f, fi.Size()
+	if rf.interval > 0 {
+		rf.next = time.Now().Truncate(rf.interval).Add(rf.interval)
+	}
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	due := rf.interval > 0 && !time.Now().Before(rf.next)
+	full := rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize
+	if due || full {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file aside and starts a new one. If the file
+// cannot be moved, logging carries on in the same file, and the next attempt
+// comes after another maxSize bytes or interval.
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	aside := rf.path + "." + time.Now().Format("20060102T150405.000")
+	renameErr := os.Rename(rf.path, aside)
+	if renameErr != nil {
+		log.Printf("Access log rotation failed: %v", renameErr)
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		rf.size = 0
+	}
+	return nil
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.f.Close()
+}
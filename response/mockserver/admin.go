@@ -0,0 +1,191 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// behaviorJSON is how the admin API shows and accepts a behavior.
+type behaviorJSON struct {
+	Delay        delayJSON  `json:"delay"`
+	Errors       errorsJSON `json:"errors"`
+	ResponseSize string     `json:"response_size"`
+	Leak         leakJSON   `json:"leak"`
+	Chaos        chaosJSON  `json:"chaos"`
+	// Sequence rules need no conversion.
+	Sequence []sequenceRule `json:"sequence"`
+}
+
+type delayJSON struct {
+	Distribution string   `json:"distribution"`
+	Base         duration `json:"base"`
+	Stddev       duration `json:"stddev"`
+	Max          duration `json:"max"`
+	ParetoAlpha  float64  `json:"pareto_alpha"`
+}
+
+type leakJSON struct {
+	Rate float64 `json:"rate"`
+	Mode string  `json:"mode"`
+}
+
+type chaosJSON struct {
+	Rate  float64  `json:"rate"`
+	Modes []string `json:"modes"`
+}
+
+type errorsJSON struct {
+	Rate  float64 `json:"rate"`
+	Codes []int   `json:"codes"`
+	Body  string  `json:"body"`
+}
+
+func newBehaviorJSON(b *behavior) behaviorJSON {
+	j := behaviorJSON{
+		Delay: delayJSON{
+			Distribution: b.delay.dist,
+			Base:         duration(b.delay.base),
+			Stddev:       duration(b.delay.stddev),
+			Max:          duration(b.delay.max),
+			ParetoAlpha:  b.delay.alpha,
+		},
+		Errors: errorsJSON{
+			Rate: b.errors.rate,
+			// Cloned so decoding into j cannot write to the live slice.
+			Codes: slices.Clone(b.errors.codes),
+			Body:  string(b.errors.body),
+		},
+		Leak:     leakJSON{Rate: b.leak.rate, Mode: b.leak.mode},
+		Chaos:    chaosJSON{Rate: b.chaos.rate, Modes: slices.Clone(b.chaos.modes)},
+		Sequence: slices.Clone(b.sequence),
+	}
+	if b.responseSize.enabled() {
+		j.ResponseSize = b.responseSize.String()
+	}
+	return j
+}
+
+// behavior converts j back and validates the result.
+func (j behaviorJSON) behavior() (*behavior, error) {
+	b := &behavior{
+		delay: delayModel{
+			dist:   j.Delay.Distribution,
+			base:   time.Duration(j.Delay.Base),
+			stddev: time.Duration(j.Delay.Stddev),
+			max:    time.Duration(j.Delay.Max),
+			alpha:  j.Delay.ParetoAlpha,
+		},
+		errors: errorInjector{
+			rate:  j.Errors.Rate,
+			codes: j.Errors.Codes,
+			body:  []byte(j.Errors.Body),
+		},
+		leak:     leakInjector{rate: j.Leak.Rate, mode: j.Leak.Mode},
+		chaos:    chaosInjector{rate: j.Chaos.Rate, modes: j.Chaos.Modes},
+		sequence: j.Sequence,
+	}
+	var err error
+	if b.responseSize, err = parseSizeRange(j.ResponseSize); err != nil {
+		return nil, err
+	}
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// adminRoutes registers the admin API under /admin/ on mux:
+//
+//	GET   /admin/config         current behaviour as JSON
+//	PATCH /admin/config         merge a partial behaviour document
+//	PUT   /admin/delay          replace fields of the "delay" section
+//	PUT   /admin/errors         replace fields of the "errors" section
+//	PUT   /admin/response-size  set the response size ("4kb", "1kb..1mb" or "")
+//	PUT   /admin/leak           replace fields of the "leak" section
+//	POST  /admin/leak/release   end the leaked goroutines and close the leaked connections
+//	PUT   /admin/chaos          replace fields of the "chaos" section
+//	PUT   /admin/sequence       replace the sequence rules (a JSON array)
+//	POST  /admin/sequence/reset start counting requests from 1 again
+//	POST  /admin/reset          restore the behaviour given on the command line
+//	POST  /admin/reload         reload the routes and behaviour of the -config file
+//
+// Every call returns the resulting behaviour.
+func (s *server) adminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/config", s.adminGet)
+	mux.HandleFunc("PATCH /admin/config", s.adminUpdate(func(j *behaviorJSON) any { return j }))
+	mux.HandleFunc("PUT /admin/delay", s.adminUpdate(func(j *behaviorJSON) any { return &j.Delay }))
+	mux.HandleFunc("PUT /admin/errors", s.adminUpdate(func(j *behaviorJSON) any { return &j.Errors }))
+	mux.HandleFunc("PUT /admin/response-size", s.adminUpdate(func(j *behaviorJSON) any { return &j.ResponseSize }))
+	mux.HandleFunc("PUT /admin/leak", s.adminUpdate(func(j *behaviorJSON) any { return &j.Leak }))
+	mux.HandleFunc("POST /admin/leak/release", s.adminReleaseLeaks)
+	mux.HandleFunc("PUT /admin/chaos", s.adminUpdate(func(j *behaviorJSON) any { return &j.Chaos }))
+	// The rules are replaced, not merged element by element.
+	mux.HandleFunc("PUT /admin/sequence", s.adminUpdate(func(j *behaviorJSON) any { j.Sequence = nil; return &j.Sequence }))
+	mux.HandleFunc("POST /admin/sequence/reset", s.adminResetSequence)
+	mux.HandleFunc("POST /admin/reset", s.adminReset)
+	mux.HandleFunc("POST /admin/reload", s.adminReload)
+}
+
+func (s *server) adminGet(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newBehaviorJSON(s.behavior.Load()))
+}
+
+// adminUpdate returns a handler that decodes the request body into the part
+// of the current behaviour selected by section. Fields missing from the body
+// keep their current values.
+func (s *server) adminUpdate(section func(*behaviorJSON) any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.adminMu.Lock()
+		defer s.adminMu.Unlock()
+
+		j := newBehaviorJSON(s.behavior.Load())
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(section(&j)); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+		b, err := j.behavior()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		s.behavior.Store(b)
+		log.Printf("Admin: behaviour updated by %s", r.RemoteAddr)
+		writeJSON(w, http.StatusOK, newBehaviorJSON(b))
+	}
+}
+
+func (s *server) adminReset(w http.ResponseWriter, r *http.Request) {
+	s.adminMu.Lock()
+	defer s.adminMu.Unlock()
+
+	initial := s.cfg.behavior
+	s.behavior.Store(&initial)
+	log.Printf("Admin: behaviour reset by %s", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, newBehaviorJSON(&initial))
+}
+
+func (s *server) adminReleaseLeaks(w http.ResponseWriter, r *http.Request) {
+	releaseLeaks()
+	log.Printf("Admin: leaks released by %s", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, newBehaviorJSON(s.behavior.Load()))
+}
+
+func (s *server) adminResetSequence(w http.ResponseWriter, r *http.Request) {
+	s.seq.Store(0)
+	log.Printf("Admin: request sequence reset by %s", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, newBehaviorJSON(s.behavior.Load()))
+}
+
+// writeJSON sends v as an indented JSON document.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
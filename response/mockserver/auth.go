@@ -0,0 +1,164 @@
+package mockserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// authenticator checks the credentials for the /auth/ routes and issues the
+// bearer tokens handed out by /login. Tokens are signed with a key generated
+// at startup, so they are only valid until the server restarts.
+type authenticator struct {
+	user, password string
+	apiKeyHeader   string
+	apiKey         string
+	// staticToken is always accepted as a bearer token when set.
+	staticToken string
+	tokenTTL    time.Duration
+	signingKey  []byte
+}
+
+func newAuthenticator(cfg *config) *authenticator {
+	user, password, _ := strings.Cut(cfg.authCredentials, ":")
+	return &authenticator{
+		user:         user,
+		password:     password,
+		apiKeyHeader: cfg.authAPIKeyHeader,
+		apiKey:       cfg.authAPIKey,
+		staticToken:  cfg.authToken,
+		tokenTTL:     cfg.authTokenTTL,
+		signingKey:   []byte(rand.Text()),
+	}
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// basicAuthHandler requires the -auth-credentials as Basic auth. Like the
+// other /auth/ routes it answers 401 Unauthorized when credentials are
+// missing, 403 Forbidden when they are wrong, and the static JSON response
+// otherwise.
+func (s *server) basicAuthHandler(w http.ResponseWriter, r *http.Request) {
+	user, password, ok := r.BasicAuth()
+	switch {
+	case !ok:
+		w.Header().Set("WWW-Authenticate", `Basic realm="mock"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing basic credentials"})
+	case !equal(user, s.auth.user) || !equal(password, s.auth.password):
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "invalid credentials"})
+	default:
+		writeAuthorized(w)
+	}
+}
+
+// bearerAuthHandler requires a bearer token from /login or -auth-token.
+func (s *server) bearerAuthHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	switch {
+	case !ok || token == "":
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mock"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing bearer token"})
+	case !s.auth.validToken(token):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mock", error="invalid_token"`)
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "invalid or expired token"})
+	default:
+		writeAuthorized(w)
+	}
+}
+
+// apiKeyAuthHandler requires -auth-api-key in the -auth-api-key-header
+// header.
+func (s *server) apiKeyAuthHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get(s.auth.apiKeyHeader)
+	switch {
+	case key == "":
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing " + s.auth.apiKeyHeader + " header"})
+	case !equal(key, s.auth.apiKey):
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "invalid API key"})
+	default:
+		writeAuthorized(w)
+	}
+}
+
+// writeAuthorized sends the static JSON response to an authenticated
+// request, marked private so that no shared cache keeps it.
+func writeAuthorized(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "private")
+	writeMock(w, http.StatusOK)
+}
+
+// loginRequest is the JSON body accepted by /login.
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// loginResponse follows the OAuth 2 token response.
+type loginResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// loginHandler exchanges the -auth-credentials, sent as a JSON body
+// ({"username": ..., "password": ...}) or with Basic auth, for a bearer token
+// accepted by /auth/bearer.
+func (s *server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if user, password, ok := r.BasicAuth(); ok {
+		req = loginRequest{Username: user, Password: password}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	if !equal(req.Username, s.auth.user) || !equal(req.Password, s.auth.password) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
+		return
+	}
+	writeJSON(w, http.StatusOK, loginResponse{
+		AccessToken: s.auth.issueToken(req.Username, time.Now().Add(s.auth.tokenTTL)),
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.auth.tokenTTL.Seconds()),
+	})
+}
+
+// issueToken returns a token for user that expires at exp, in the form
+// base64(user).expiry.signature.
+func (a *authenticator) issueToken(user string, exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(user)) + "." + strconv.FormatInt(exp.Unix(), 10)
+	return payload + "." + a.sign(payload)
+}
+
+func (a *authenticator) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.signingKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validToken reports whether token is the static token, or was issued by
+// this server and has not expired.
+func (a *authenticator) validToken(token string) bool {
+	if a.staticToken != "" && equal(token, a.staticToken) {
+		return true
+	}
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return false
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(a.sign(payload))) {
+		return false
+	}
+	_, expiry, _ := strings.Cut(payload, ".")
+	exp, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && time.Now().Unix() < exp
+}
@@ -0,0 +1,50 @@
+package mockserver
+
+import "fmt"
+
+// behavior is the part of the mock handler's configuration that can change
+// while the server is running. Values are immutable once published: changes
+// build a new behavior and swap it in, so each request sees one consistent
+// snapshot.
+type behavior struct {
+	// delay is the artificial latency added to every mock response.
+	delay delayModel
+	// errors makes a fraction of mock responses fail.
+	errors errorInjector
+	// responseSize, when set, replaces the JSON body with a generated
+	// payload whose size is drawn from this range.
+	responseSize sizeRange
+	// leak makes a fraction of requests leak a goroutine or connection.
+	leak leakInjector
+	// sequence injects faults into requests chosen by number.
+	sequence []sequenceRule
+	// fanout adds the latency and failures of simulated downstream calls.
+	fanout fanoutModel
+	// chaos breaks a fraction of connections.
+	chaos chaosInjector
+}
+
+// validate checks every part of the behaviour.
+func (b *behavior) validate() error {
+	if err := b.delay.validate(); err != nil {
+		return fmt.Errorf("invalid delay settings: %w", err)
+	}
+	if err := b.errors.validate(); err != nil {
+		return fmt.Errorf("invalid error injection settings: %w", err)
+	}
+	if err := b.leak.validate(); err != nil {
+		return fmt.Errorf("invalid leak settings: %w", err)
+	}
+	if err := b.fanout.validate(); err != nil {
+		return fmt.Errorf("invalid fan-out settings: %w", err)
+	}
+	if err := b.chaos.validate(); err != nil {
+		return fmt.Errorf("invalid chaos settings: %w", err)
+	}
+	for i, r := range b.sequence {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("invalid sequence rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package mockserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"server/metrics"
+)
+
+// bodyLimits applies the request body rules to every route: bodies larger
+// than max bytes (0 for no limit) are refused with 413 Content Too Large, and
+// with validateJSON, JSON bodies that do not parse are refused with 400.
+// Body bytes read by the server are counted in the metrics.
+type bodyLimits struct {
+	max          int64
+	validateJSON bool
+}
+
+func (b *bodyLimits) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if b.max > 0 && r.ContentLength > b.max {
+			rejectBody(w, http.StatusRequestEntityTooLarge, "too_large", "request body too large")
+			return
+		}
+
+		counted := &countingBody{ReadCloser: r.Body}
+		defer func() { metrics.RequestBodyBytes(counted.n) }()
+		r.Body = counted
+		if b.max > 0 {
+			r.Body = http.MaxBytesReader(w, counted, b.max)
+		}
+
+		if b.validateJSON && isJSON(r.Header.Get("Content-Type")) {
+			data, err := io.ReadAll(r.Body)
+			switch {
+			case bodyTooLarge(err):
+				rejectBody(w, http.StatusRequestEntityTooLarge, "too_large", "request body too large")
+				return
+			case err != nil:
+				// The client went away mid-body.
+				return
+			case !json.Valid(data):
+				rejectBody(w, http.StatusBadRequest, "invalid_json", "request body is not valid JSON")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(data))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func rejectBody(w http.ResponseWriter, status int, reason, msg string) {
+	metrics.RequestBodyRejected(reason)
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// drainBody reads and discards the request body the way a real backend that
+// parses it would, so size limits apply and the bytes are counted. It answers
+// 413 and returns false if the body is too large.
+func drainBody(w http.ResponseWriter, r *http.Request) bool {
+	if _, err := io.Copy(io.Discard, r.Body); bodyTooLarge(err) {
+		rejectBody(w, http.StatusRequestEntityTooLarge, "too_large", "request body too large")
+		return false
+	}
+	return true
+}
+
+func bodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+// isJSON reports whether a Content-Type is JSON, including +json types such
+// as application/problem+json.
+func isJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,65 @@
+package mockserver
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cachePolicy adds HTTP caching headers to successful mock responses and
+// answers conditional GET and HEAD requests for them with 304 Not Modified.
+type cachePolicy struct {
+	etags bool
+	// lastModified is sent as Last-Modified; zero disables it.
+	lastModified time.Time
+	// cacheControl is sent as Cache-Control when not empty.
+	cacheControl string
+}
+
+// notModified sets the caching headers for a 200 response whose body is
+// identified by etag. If the request's If-None-Match or If-Modified-Since
+// shows the client already has that body, it sends 304 and returns true.
+func (c *cachePolicy) notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	h := w.Header()
+	if c.cacheControl != "" {
+		h.Set("Cache-Control", c.cacheControl)
+	}
+	if c.etags {
+		h.Set("ETag", etag)
+	}
+	if !c.lastModified.IsZero() {
+		h.Set("Last-Modified", c.lastModified.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since (RFC 9110
+	// section 13.2.2).
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !c.etags || !etagMatch(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !c.lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil || c.lastModified.After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch reports whether an If-None-Match list matches etag, using the
+// weak comparison the header calls for.
+func etagMatch(list, etag string) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package mockserver
+
+import "net/http"
+
+// middleware wraps a handler in some behaviour, e.g. a rate limit or the
+// access log.
+type middleware func(http.Handler) http.Handler
+
+// chain is an ordered list of middleware. The first one used is the
+// outermost: it sees the request first and the response last, so
+//
+//	var c chain
+//	c.use(withRequestID, recoverPanics)
+//	h := c.then(mux)
+//
+// gives every request an ID before any panic is recovered, and the recovered
+// 500 still carries it. The zero value is an empty chain.
+type chain struct {
+	mws []middleware
+}
+
+// use appends mws to c, inside the middleware already used.
+func (c *chain) use(mws ...middleware) {
+	c.mws = append(c.mws, mws...)
+}
+
+// then wraps h in the middleware of c.
+func (c *chain) then(h http.Handler) http.Handler {
+	for i := len(c.mws) - 1; i >= 0; i-- {
+		h = c.mws[i](h)
+	}
+	return h
+}
+
+// routeChain is the middleware of every route: the request metrics, under
+// label, the 503 of the request deadline and the naming of the route's span.
+func (s *server) routeChain(label string) *chain {
+	c := &chain{}
+	c.use(s.httpMetrics.Middleware(label), deadlineResponse, func(h http.Handler) http.Handler {
+		return traceRoute(h.ServeHTTP)
+	})
+	return c
+}
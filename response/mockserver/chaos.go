@@ -0,0 +1,137 @@
+package mockserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"server/metrics"
+)
+
+// Chaos modes, each breaking a response in a different way.
+const (
+	chaosReset     = "reset"     // send part of the body, then reset the TCP connection
+	chaosClose     = "close"     // close the connection without any response
+	chaosMalformed = "malformed" // send an unparseable response header, then close
+	chaosStall     = "stall"     // never respond; hold the request until the client gives up
+)
+
+var chaosModes = []string{chaosReset, chaosClose, chaosMalformed, chaosStall}
+
+// parseChaosModes parses a comma-separated list of chaos modes.
+func parseChaosModes(s string) ([]string, error) {
+	var modes []string
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		if !slices.Contains(chaosModes, m) {
+			return nil, fmt.Errorf("unknown chaos mode %q (want %s)", m, strings.Join(chaosModes, ", "))
+		}
+		modes = append(modes, m)
+	}
+	return modes, nil
+}
+
+// chaosInjector breaks a fraction rate of responses with a random one of
+// modes, to check how clients handle and classify broken connections.
+type chaosInjector struct {
+	rate  float64
+	modes []string
+}
+
+func (c chaosInjector) validate() error {
+	if c.rate < 0 || c.rate > 1 {
+		return fmt.Errorf("chaos rate must be between 0 and 1, got %v", c.rate)
+	}
+	if c.rate > 0 && len(c.modes) == 0 {
+		return errors.New("chaos needs at least one mode")
+	}
+	for _, m := range c.modes {
+		if !slices.Contains(chaosModes, m) {
+			return fmt.Errorf("unknown chaos mode %q (want %s)", m, strings.Join(chaosModes, ", "))
+		}
+	}
+	return nil
+}
+
+// chaos wraps next so that the requests picked by the current behaviour get
+// a broken response. A request can ask for a specific mode with ?chaos= or
+// the x-inject-chaos header.
+//
+// HTTP/2 and HTTP/3 connections are shared by many requests and cannot be
+// taken over, so there every mode except stall resets just the stream.
+func (s *server) chaos(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		c := s.behavior.Load().chaos
+		mode, source := overrideValue(r, "chaos"), "override"
+		if mode == "" && c.rate > 0 && rand.Float64() < c.rate {
+			mode, source = c.modes[rand.IntN(len(c.modes))], "random"
+		}
+		if mode == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !slices.Contains(chaosModes, mode) {
+			http.Error(w, fmt.Sprintf("invalid chaos %q (want %s)", mode, strings.Join(chaosModes, ", ")), http.StatusBadRequest)
+			return
+		}
+		metrics.ChaosAction(mode, source)
+		breakResponse(w, r, mode)
+	})
+}
+
+// breakResponse carries out a chaos mode on the request.
+func breakResponse(w http.ResponseWriter, r *http.Request, mode string) {
+	if mode == chaosStall {
+		<-r.Context().Done()
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	if mode == chaosReset {
+		// Promise more body than is ever sent.
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", "65536")
+		w.WriteHeader(http.StatusOK)
+		w.Write(make([]byte, 4096))
+		rc.Flush()
+	}
+
+	conn, buf, err := rc.Hijack()
+	if err != nil {
+		// Not HTTP/1: abort the stream instead.
+		panic(http.ErrAbortHandler)
+	}
+	defer conn.Close()
+
+	switch mode {
+	case chaosReset:
+		// Closing with a zero linger time sends RST instead of FIN.
+		if tcp, ok := tcpConn(conn); ok {
+			tcp.SetLinger(0)
+		}
+	case chaosMalformed:
+		buf.WriteString("HTTP/1.1 2OO OK\r\nContent-Length: -1\r\nthis is not a header\r\n\r\n")
+		if err := buf.Flush(); err != nil {
+			log.Printf("Chaos: writing malformed response: %v", err)
+		}
+	}
+}
+
+// tcpConn returns the TCP connection under c, which may be wrapped in TLS.
+func tcpConn(c net.Conn) (*net.TCPConn, bool) {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	tcp, ok := c.(*net.TCPConn)
+	return tcp, ok
+}
@@ -0,0 +1,161 @@
+package mockserver
+
+import (
+	"cmp"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"server/metrics"
+)
+
+// otherClients collects the clients seen after the -client-stats cap was
+// reached.
+const otherClients = "other"
+
+// Latency histogram used for the per-client percentiles: exponential buckets
+// from 100µs growing by 25%, the last one open-ended (about 80s and up).
+const (
+	latencyBuckets = 64
+	latencyBase    = 100 * time.Microsecond
+	latencyGrowth  = 1.25
+)
+
+// clientStats aggregates request counts and latencies per client IP, so
+// distributed runs can check how the load was spread over the generators.
+// At most max clients are tracked separately; the rest share one entry.
+type clientStats struct {
+	max int
+
+	mu      sync.Mutex
+	clients map[string]*clientEntry
+	// labelled are the clients with their own series in the client
+	// metrics. It survives DELETE /stats/clients, since the series do, so
+	// that resets cannot raise the metrics' cardinality past max.
+	labelled map[string]bool
+}
+
+type clientEntry struct {
+	requests, errors int64
+	maxLatency       time.Duration
+	buckets          [latencyBuckets]int64
+}
+
+func newClientStats(max int) *clientStats {
+	return &clientStats{max: max, clients: make(map[string]*clientEntry), labelled: make(map[string]bool)}
+}
+
+func (c *clientStats) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		c.record(clientIP(r), rec.status, time.Since(start))
+	})
+}
+
+func (c *clientStats) record(ip string, status int, latency time.Duration) {
+	c.mu.Lock()
+	label := ip
+	if !c.labelled[ip] {
+		if len(c.labelled) < c.max {
+			c.labelled[ip] = true
+		} else {
+			label = otherClients
+		}
+	}
+	e, ok := c.clients[ip]
+	if !ok {
+		if len(c.clients) >= c.max {
+			ip = otherClients
+			e = c.clients[ip]
+		}
+		if e == nil {
+			e = &clientEntry{}
+			c.clients[ip] = e
+		}
+	}
+	e.requests++
+	if status >= 500 {
+		e.errors++
+	}
+	e.maxLatency = max(e.maxLatency, latency)
+	e.buckets[latencyBucket(latency)]++
+	c.mu.Unlock()
+	metrics.ClientRequest(label)
+}
+
+func latencyBucket(d time.Duration) int {
+	if d <= latencyBase {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(latencyBase)) / math.Log(latencyGrowth)))
+	return min(i, latencyBuckets-1)
+}
+
+// quantile returns the upper bound of the bucket holding quantile q, capped
+// at the largest latency seen.
+func (e *clientEntry) quantile(q float64) time.Duration {
+	rank := int64(math.Ceil(q * float64(e.requests)))
+	var seen int64
+	for i, n := range e.buckets {
+		seen += n
+		if seen >= rank {
+			return min(latencyBound(i), e.maxLatency)
+		}
+	}
+	return e.maxLatency
+}
+
+// clientSummary is one client in /stats/clients.
+type clientSummary struct {
+	Client   string   `json:"client"`
+	Requests int64    `json:"requests"`
+	Errors   int64    `json:"errors"`
+	P50      duration `json:"p50"`
+	P90      duration `json:"p90"`
+	P99      duration `json:"p99"`
+	Max      duration `json:"max"`
+}
+
+// summary lists the clients, busiest first.
+func (c *clientStats) summary() []clientSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]clientSummary, 0, len(c.clients))
+	for ip, e := range c.clients {
+		out = append(out, clientSummary{
+			Client:   ip,
+			Requests: e.requests,
+			Errors:   e.errors,
+			P50:      duration(e.quantile(0.5)),
+			P90:      duration(e.quantile(0.9)),
+			P99:      duration(e.quantile(0.99)),
+			Max:      duration(e.maxLatency),
+		})
+	}
+	slices.SortFunc(out, func(a, b clientSummary) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Client, b.Client))
+	})
+	return out
+}
+
+// clientStatsHandler lists the request count, 5xx errors and approximate
+// latency percentiles of every client IP; DELETE clears them, but not the
+// client metrics.
+func (s *server) clientStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		s.clients.mu.Lock()
+		clear(s.clients.clients)
+		s.clients.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.clients.summary())
+}
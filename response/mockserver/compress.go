@@ -0,0 +1,264 @@
+package mockserver
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+
+	"server/metrics"
+)
+
+// compressor compresses responses with gzip or brotli, as negotiated with the
+// request's Accept-Encoding header. Responses smaller than minSize are sent
+// as they are, since compressing them costs more than it saves.
+type compressor struct {
+	encodings []string // supported encodings in order of preference
+	minSize   int64
+	gzipPool  sync.Pool
+	brPool    sync.Pool
+}
+
+// newCompressor returns a compressor for a comma-separated list of encodings
+// ("gzip", "br"), preferred in the given order. level is the compression
+// level for both encodings; -1 means each encoder's default.
+func newCompressor(encodings string, minSize int64, level int) (*compressor, error) {
+	if level != -1 && (level < 1 || level > 9) {
+		return nil, fmt.Errorf("compression level %d out of range (1-9, or -1 for the default)", level)
+	}
+	c := &compressor{minSize: minSize}
+	for _, enc := range strings.Split(encodings, ",") {
+		switch enc = strings.TrimSpace(enc); enc {
+		case "gzip":
+			c.gzipPool.New = func() any {
+				zw, _ := gzip.NewWriterLevel(io.Discard, cmpLevel(level, gzip.DefaultCompression))
+				return zw
+			}
+		case "br":
+			c.brPool.New = func() any {
+				return brotli.NewWriterLevel(io.Discard, cmpLevel(level, brotli.DefaultCompression))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported encoding %q (want gzip or br)", enc)
+		}
+		c.encodings = append(c.encodings, enc)
+	}
+	return c, nil
+}
+
+func cmpLevel(level, def int) int {
+	if level == -1 {
+		return def
+	}
+	return level
+}
+
+func (c *compressor) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		enc := c.negotiate(r.Header.Get("Accept-Encoding"))
+		if enc == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, c: c, encoding: enc, status: http.StatusOK}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiate picks the most preferred supported encoding with a non-zero
+// quality in an Accept-Encoding header, or "" if there is none.
+func (c *compressor) negotiate(accept string) string {
+	if accept == "" {
+		return ""
+	}
+	q := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		q[strings.ToLower(strings.TrimSpace(name))] = weight
+	}
+	best, bestQ := "", 0.0
+	for _, enc := range c.encodings {
+		w, ok := q[enc]
+		if !ok {
+			w, ok = q["*"]
+		}
+		if ok && w > bestQ {
+			best, bestQ = enc, w
+		}
+	}
+	return best
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// the body is big enough to be worth compressing: either from Content-Length
+// or once minSize bytes have been written.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+
+	status      int
+	wroteHeader bool     // the handler called WriteHeader
+	started     bool     // headers were sent downstream
+	buf         []byte   // body held back until started
+	enc         encoder  // nil when sending uncompressed
+	out         *counter // compressed bytes written downstream
+	in          int64    // uncompressed bytes written by the handler
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// counter counts the bytes written through it.
+type counter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	if code < 200 {
+		// Informational responses pass straight through.
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = code
+	h := cw.Header()
+	switch {
+	case code == http.StatusNoContent || code == http.StatusNotModified,
+		h.Get("Content-Encoding") != "", h.Get("Content-Range") != "":
+		cw.start(false)
+	case h.Get("Content-Length") != "":
+		n, _ := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+		cw.start(n >= cw.c.minSize)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	cw.in += int64(len(p))
+	if !cw.started {
+		cw.buf = append(cw.buf, p...)
+		if int64(len(cw.buf)) < cw.c.minSize {
+			return len(p), nil
+		}
+		cw.start(true)
+		return len(p), cw.flushBuf()
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// start sends the headers, compressed or not, and then anything buffered.
+func (cw *compressWriter) start(compress bool) {
+	cw.started = true
+	if compress {
+		h := cw.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		cw.out = &counter{w: cw.ResponseWriter}
+		cw.enc = cw.c.getEncoder(cw.encoding)
+		cw.enc.Reset(cw.out)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+func (cw *compressWriter) flushBuf() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+// Flush sends what has been written so far. A response flushed before its
+// size is known is compressed, since it is most likely a stream.
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.started {
+		cw.start(true)
+		cw.flushBuf()
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for
+// anything other than flushing.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close finishes the response once the handler has returned.
+func (cw *compressWriter) close() {
+	if !cw.wroteHeader {
+		// The handler wrote nothing at all: let net/http send its default.
+		return
+	}
+	if !cw.started {
+		cw.start(false)
+		cw.flushBuf()
+		return
+	}
+	if cw.enc == nil {
+		return
+	}
+	cw.enc.Close()
+	cw.c.putEncoder(cw.encoding, cw.enc)
+	metrics.Compressed(cw.encoding, cw.in, cw.out.n)
+}
+
+func (c *compressor) getEncoder(encoding string) encoder {
+	if encoding == "br" {
+		return c.brPool.Get().(*brotli.Writer)
+	}
+	return c.gzipPool.Get().(*gzip.Writer)
+}
+
+func (c *compressor) putEncoder(encoding string, e encoder) {
+	e.Reset(io.Discard)
+	if encoding == "br" {
+		c.brPool.Put(e)
+	} else {
+		c.gzipPool.Put(e)
+	}
+}
@@ -0,0 +1,88 @@
+package mockserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"server/metrics"
+)
+
+// concurrencyLimiter lets at most limit requests run at once. Up to queue
+// more wait for a free slot for at most wait; anything beyond that, or a
+// request that waits too long, is shed with 503 Service Unavailable.
+type concurrencyLimiter struct {
+	slots chan struct{}
+	queue chan struct{}
+	wait  time.Duration
+}
+
+func newConcurrencyLimiter(limit, queue int, wait time.Duration) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		slots: make(chan struct{}, limit),
+		queue: make(chan struct{}, queue),
+		wait:  wait,
+	}
+}
+
+func (cl *concurrencyLimiter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if reason := cl.acquire(r); reason != "" {
+			metrics.Shed(reason)
+			w.Header().Set("Retry-After", "1")
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "server overloaded"})
+			return
+		}
+		defer cl.release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire takes a slot, queueing if none is free. It returns why the request
+// was shed ("queue_full", "queue_timeout", "deadline" or "canceled"), or ""
+// once it holds a slot.
+func (cl *concurrencyLimiter) acquire(r *http.Request) string {
+	select {
+	case cl.slots <- struct{}{}:
+		return ""
+	default:
+	}
+
+	select {
+	case cl.queue <- struct{}{}:
+	default:
+		return "queue_full"
+	}
+	metrics.SetQueueDepth(len(cl.queue))
+	defer func() {
+		<-cl.queue
+		metrics.SetQueueDepth(len(cl.queue))
+	}()
+
+	var timeout <-chan time.Time
+	if cl.wait > 0 {
+		t := time.NewTimer(cl.wait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case cl.slots <- struct{}{}:
+		return ""
+	case <-timeout:
+		return "queue_timeout"
+	case <-r.Context().Done():
+		if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			return "deadline"
+		}
+		return "canceled"
+	}
+}
+
+func (cl *concurrencyLimiter) release() {
+	<-cl.slots
+}
@@ -0,0 +1,791 @@
+package mockserver
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"server/metrics"
+)
+
+// config holds the server settings collected from flags and the environment.
+// Flags always win; environment variables only change the defaults.
+type config struct {
+	// addr is the full listen address. When set it overrides host and port.
+	addr string
+	// host is the interface to bind to; empty means all interfaces.
+	host string
+	port int
+	// shutdownTimeout bounds how long in-flight requests may take to
+	// finish after SIGINT or SIGTERM.
+	shutdownTimeout time.Duration
+	// readyFormat is how the listeners are announced on stdout once they
+	// are open: text or json. readyFD (if not 0) and readyFile also get
+	// the JSON line.
+	readyFormat string
+	readyFD     int
+	readyFile   string
+	// envFile gets the bound addresses as shell variables.
+	envFile string
+
+	// Limits applied to every http.Server; zero disables a timeout.
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	// unixSocket, if set, is a unix socket path served in addition to TCP,
+	// or instead of it with unixOnly.
+	unixSocket string
+	unixOnly   bool
+	// listeners are extra mock listeners, each with its own behaviour.
+	listeners []listenerSpec
+	// configFile is the -config file; routes are its per-route behaviours.
+	configFile string
+	routes     []routeSpec
+	// showVersion makes Main print the version instead of serving.
+	showVersion bool
+	// cmdLine holds the flags given on the command line, which the
+	// -config file does not override.
+	cmdLine map[string]bool
+	// flags is the flag set the config was parsed from, which the -config
+	// file sets by name.
+	flags *flag.FlagSet
+	// tenants share the main listeners, picked by Host or tenantHeader.
+	tenants      []tenantSpec
+	tenantHeader string
+	// h2c enables cleartext HTTP/2 (prior knowledge) on plain listeners.
+	h2c bool
+
+	// Logging.
+	logFormat string
+	logSample float64
+	// logKeepErrors and logKeepSlow select requests logged whatever
+	// logSample.
+	logKeepErrors bool
+	logKeepSlow   time.Duration
+
+	// Options of the HTTP request metrics.
+	metricsBuckets []float64
+	metricsPrefix  string
+	metricsLabels  map[string]string
+	// metricsNativeFactor enables native histograms; 0 disables.
+	metricsNativeFactor float64
+	// metricsDuration is histogram, summary or both; metricsObjectives are
+	// the quantiles of the summary and their allowed errors.
+	metricsDuration   string
+	metricsObjectives map[float64]float64
+	// metricsRoutes caps the route label; 0 disables it.
+	metricsRoutes int
+	// metricsSkipPaths and metricsSkipMethods are left out of the request
+	// metrics and the access log.
+	metricsSkipPaths   []string
+	metricsSkipMethods []string
+	// metricsHeaderLabels are labels taken from request headers, with at
+	// most metricsHeaderValues values each.
+	metricsHeaderLabels []metrics.HeaderLabel
+	metricsHeaderValues int
+	// metricsBackend is where the request metrics go: prometheus, otel
+	// (to the -otlp-endpoint collector) or statsd (to statsdAddr).
+	metricsBackend string
+	statsdAddr     string
+	// registry holds the server's metrics when set with WithRegistry;
+	// nil means the default registry.
+	registry *prometheus.Registry
+
+	// accessLog is a file receiving Common/Combined Log Format lines.
+	accessLog         string
+	accessLogCombined bool
+	accessLogMaxSize  int64
+	accessLogRotate   time.Duration
+
+	// Rate limits in requests per second; 0 disables.
+	rateLimit       float64
+	rateBurst       int
+	clientRateLimit float64
+	clientRateBurst int
+
+	// responseBandwidth limits response writes in bytes per second; 0
+	// disables.
+	responseBandwidth int64
+
+	// Request body rules; maxBodySize 0 means unlimited.
+	maxBodySize  int64
+	validateJSON bool
+	// problemJSON sends errors as application/problem+json.
+	problemJSON bool
+	// ipFilter is nil when neither -allow-cidr nor -deny-cidr is set.
+	ipFilter *ipFilter
+	// expectContinue is how "Expect: 100-continue" requests are answered.
+	expectContinue       string
+	expectContinueDelay  time.Duration
+	expectContinueStatus int
+
+	// Concurrency limit; 0 disables.
+	maxConcurrent int
+	queueSize     int
+	queueTimeout  time.Duration
+	// requestTimeout bounds the handling of each request; 0 disables it.
+	requestTimeout time.Duration
+
+	// Response compression; empty compress disables it.
+	compress        string
+	compressMinSize int64
+	compressLevel   int
+
+	// Connection reuse settings.
+	disableKeepAlive     bool
+	maxKeepAliveRequests int64
+	tcpKeepAlive         time.Duration
+	// reusePort sets SO_REUSEPORT on the listeners.
+	reusePort bool
+
+	// TLS settings. With tlsAddr set, HTTPS is served there in addition to
+	// plain HTTP on the main address; otherwise the main address uses TLS.
+	tlsCert       string
+	tlsKey        string
+	tlsSelfSigned bool
+	tlsAddr       string
+	// mTLS settings.
+	clientCA          string
+	requireClientCert bool
+	// http3 serves HTTP/3 over QUIC, on http3Addr or the TLS address.
+	http3     bool
+	http3Addr string
+
+	// behavior is the initial runtime behaviour of the mock handler. It
+	// can be changed later through the admin API.
+	behavior behavior
+	// Scheduled degradation; degradeEvery 0 disables it.
+	degradeEvery  time.Duration
+	degradeFor    time.Duration
+	degradeDelay  time.Duration
+	degradeStatus int
+	// Latency ramp; rampRate 0 disables it.
+	rampRate        time.Duration
+	rampInterval    time.Duration
+	rampExponential bool
+	rampFactor      float64
+	rampMax         time.Duration
+	// payloadSeed seeds the generated payload contents.
+	payloadSeed uint64
+
+	// Caching headers on successful mock responses.
+	etags        bool
+	lastModified bool
+	cacheControl string
+	// Server-side response cache; a zero responseCacheTTL disables it.
+	responseCacheTTL  time.Duration
+	responseCacheSize int
+
+	// Settings for the built-in scenario routes.
+	slowDelay   time.Duration
+	errorStatus int
+	randomDelay durationRange
+	randomSize  sizeRange
+	largeSize   int64
+	echoMaxBody int64
+	// saveUploads, if set, is where /upload keeps the uploaded parts.
+	saveUploads  string
+	pollInterval time.Duration
+	pollTimeout  time.Duration
+	// Safety limits for /burn and /alloc.
+	maxBurn  time.Duration
+	maxAlloc int64
+
+	// Credentials accepted by the /auth/ routes and /login.
+	authCredentials  string
+	authAPIKeyHeader string
+	authAPIKey       string
+	authToken        string
+	authTokenTTL     time.Duration
+
+	// staticDir, if set, is served under staticPrefix.
+	staticDir    string
+	staticPrefix string
+
+	// upstream, if set, is the backend the catch-all route proxies to
+	// instead of sending the mock response.
+	upstream *url.URL
+	// mirror, if set, receives a copy of a fraction mirrorRate of the
+	// proxied requests.
+	mirror        *url.URL
+	mirrorRate    float64
+	mirrorTimeout time.Duration
+
+	// mocksFile is an optional YAML file of stub definitions, reloaded on
+	// SIGHUP or when it changes (checked every mocksPoll).
+	mocksFile string
+	mocksPoll time.Duration
+	// graphqlFile, if set, configures the /graphql endpoint.
+	graphqlFile string
+	// openAPISpec, if set, is an OpenAPI 3 spec that requests must follow.
+	openAPISpec string
+
+	// recordRequests is how many requests with an X-Mgc-Test-Id are kept
+	// for /requests; 0 disables recording.
+	recordRequests int
+	// inspectSize is how many requests /__inspect shows; 0 disables it.
+	inspectSize    int
+	inspectMaxBody int64
+	// clientStats caps the client IPs tracked for /stats/clients; 0
+	// disables the tracking.
+	clientStats int
+	// statsWindow is how long /stats keeps the per-second request stats;
+	// 0 disables them.
+	statsWindow time.Duration
+	// serverTiming adds a Server-Timing header to every response.
+	serverTiming bool
+	// otlpEndpoint, if set, receives the request spans over OTLP/HTTP.
+	otlpEndpoint    string
+	traceSampleRate float64
+
+	// grpcAddr, if set, serves the mock gRPC service there.
+	grpcAddr string
+	// Raw echo listeners, disabled when empty.
+	tcpEchoAddr string
+	udpEchoAddr string
+
+	// adminAddr, if set, moves the admin API to its own listener.
+	adminAddr string
+	// enablePprof serves /debug/ on the main listener.
+	enablePprof bool
+}
+
+// parseConfig registers the server flags on fs, parses args and returns the
+// resulting config.
+func parseConfig(fs *flag.FlagSet, args []string) (*config, error) {
+	cfg := &config{flags: fs}
+	fs.StringVar(&cfg.configFile, "config", "", "YAML file setting any of these flags by name, plus per-route behaviour under routes; command-line flags take precedence")
+	fs.StringVar(&cfg.addr, "addr", envString("MOCK_ADDR", ""), "Full listen address (host:port); overrides -host and -port [$MOCK_ADDR]")
+	fs.StringVar(&cfg.host, "host", envString("MOCK_HOST", ""), "Interface or IP to bind to; empty binds all interfaces [$MOCK_HOST]")
+	fs.IntVar(&cfg.port, "port", envInt("MOCK_PORT", envInt("PORT", 8080)), "Port to listen on; 0 picks a free one, announced once listening (see -ready-format and -env-file) [$MOCK_PORT, $PORT]")
+	fs.StringVar(&cfg.unixSocket, "unix", "", "Also listen on this unix socket path (e.g. /tmp/mock.sock), in plain HTTP even with TLS unless -unix-only is set")
+	fs.BoolVar(&cfg.unixOnly, "unix-only", false, "Listen only on the -unix socket, not on TCP")
+	var listenSpecs []string
+	fs.Func("listen", "Extra listener with its own behaviour, sharing the rate, concurrency and cache limits of the main one, as addr?options (e.g. ':8081?name=slow&delay=100ms', ':8443?tls'); repeatable", func(s string) error {
+		listenSpecs = append(listenSpecs, s)
+		return nil
+	})
+	var tenantSpecs []string
+	fs.Func("tenant", "Emulated service on the main listeners with its own behaviour, sharing their rate, concurrency and cache limits, as host?options picked by the Host header or -tenant-header (e.g. 'payments.local?name=payments&delay=100ms'); repeatable", func(s string) error {
+		tenantSpecs = append(tenantSpecs, s)
+		return nil
+	})
+	fs.StringVar(&cfg.tenantHeader, "tenant-header", "", "Pick the -tenant by the value of this header (e.g. X-Tenant) instead of the Host header")
+	fs.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 30*time.Second, "How long to wait for in-flight requests to finish on SIGINT/SIGTERM")
+	fs.StringVar(&cfg.readyFormat, "ready-format", "text", "How the listeners are announced on stdout once they are open: text (one line each) or json (a single line with the bound addresses)")
+	fs.IntVar(&cfg.readyFD, "ready-fd", 0, "Also write the JSON readiness line to this inherited file descriptor (e.g. 3) and close it; 0 disables")
+	fs.StringVar(&cfg.readyFile, "ready-file", "", "Also write the JSON readiness line to this file, replacing it atomically once the server is ready")
+	fs.StringVar(&cfg.envFile, "env-file", "", "Once the server is ready, write the bound addresses to this file as MOCK_SERVER_ADDR, MOCK_SERVER_PORT, MOCK_SERVER_URL and MOCK_SERVER_<LISTENER>_* lines for sourcing in a shell or a CI job")
+
+	fs.StringVar(&cfg.logFormat, "log-format", envString("MOCK_LOG_FORMAT", "logfmt"), "Log format: logfmt or json [$MOCK_LOG_FORMAT]")
+	fs.Float64Var(&cfg.logSample, "log-sample", 1, "Fraction (0-1) of requests written to the access log, besides those kept by -log-keep-errors and -log-keep-slow; 0 logs only those")
+	fs.BoolVar(&cfg.logKeepErrors, "log-keep-errors", true, "Write every failed request (status 400 and above) to the access log, whatever -log-sample")
+	fs.DurationVar(&cfg.logKeepSlow, "log-keep-slow", 0, "Write every request slower than this to the access log, whatever -log-sample (e.g. 500ms); 0 disables")
+
+	metricsBuckets := fs.String("metrics-buckets", "", "Comma-separated upper bounds of the request duration histogram buckets (e.g. 100us,500us,1ms,5ms,25ms,100ms,1s); empty uses the Prometheus defaults of 5ms to 10s")
+	fs.StringVar(&cfg.metricsPrefix, "metrics-prefix", "go_server", "Prefix of the HTTP request metric names")
+	fs.Float64Var(&cfg.metricsNativeFactor, "metrics-native-histogram", 0, "Also export the request duration as a native histogram whose buckets grow by this factor (e.g. 1.1); 0 disables")
+	fs.StringVar(&cfg.metricsDuration, "metrics-duration", "histogram", "Type of the request duration metric: histogram, summary (quantiles computed by the server) or both")
+	metricsQuantiles := fs.String("metrics-quantiles", "0.5,0.9,0.99", "Comma-separated quantiles of the request duration summary of -metrics-duration")
+	fs.IntVar(&cfg.metricsRoutes, "metrics-routes", 0, "Add a route label to the request metrics (the matched pattern, or the path with IDs replaced by {id} for catch-all routes), with at most this many values before \"other\"; 0 disables")
+	metricsSkipPaths := fs.String("metrics-skip-paths", "", "Comma-separated paths left out of the request metrics and the access log (e.g. /healthz,/favicon.ico); a path ending in / covers the paths below it")
+	metricsSkipMethods := fs.String("metrics-skip-methods", "", "Comma-separated methods left out of the request metrics and the access log (e.g. OPTIONS,HEAD)")
+	fs.StringVar(&cfg.metricsBackend, "metrics-backend", "prometheus", "Backend of the HTTP request metrics: prometheus (served on /metrics), otel (exported to the -otlp-endpoint collector) or statsd (sent to -statsd-addr)")
+	fs.StringVar(&cfg.statsdAddr, "statsd-addr", "127.0.0.1:8125", "UDP address of the statsd server of -metrics-backend=statsd")
+	metricsHeaderLabels := fs.String("metrics-header-labels", "", "Comma-separated request headers added as labels to the HTTP request metrics, as name=Header or just Header (e.g. X-Tenant-Id,client_version=X-Client-Version); a bare header gives a label named like x_tenant_id")
+	fs.IntVar(&cfg.metricsHeaderValues, "metrics-header-values", 100, "Values of each -metrics-header-labels label before \"other\"")
+	metricsLabels := fs.String("metrics-labels", "", "Comma-separated name=value labels added to the HTTP request metrics (e.g. env=ci,run=42)")
+
+	fs.StringVar(&cfg.accessLog, "access-log", "", "Also write access logs in Common/Combined Log Format to this file")
+	accessLogFormat := fs.String("access-log-format", "combined", "Format of -access-log: common or combined")
+	accessLogMaxSize := fs.String("access-log-max-size", "", "Rotate -access-log when it would grow beyond this size (e.g. 100mb); empty means never")
+	fs.DurationVar(&cfg.accessLogRotate, "access-log-rotate", 0, "Rotate -access-log at every multiple of this interval (e.g. 24h); 0 means never")
+
+	fs.DurationVar(&cfg.readTimeout, "read-timeout", 0, "Maximum time to read a whole request, including the body; 0 means none")
+	fs.DurationVar(&cfg.readHeaderTimeout, "read-header-timeout", 10*time.Second, "Maximum time to read request headers; 0 means none")
+	fs.DurationVar(&cfg.writeTimeout, "write-timeout", 0, "Maximum time from the end of the request headers to the end of the response; 0 means none")
+	fs.DurationVar(&cfg.idleTimeout, "idle-timeout", 120*time.Second, "How long an idle keep-alive connection is kept open; 0 falls back to -read-timeout")
+	fs.IntVar(&cfg.maxHeaderBytes, "max-header-bytes", http.DefaultMaxHeaderBytes, "Maximum size of request headers in bytes")
+	fs.BoolVar(&cfg.h2c, "h2c", false, "Also accept cleartext HTTP/2 with prior knowledge on non-TLS listeners")
+
+	fs.BoolVar(&cfg.disableKeepAlive, "disable-keepalive", false, "Close every connection after one response")
+	fs.Int64Var(&cfg.maxKeepAliveRequests, "max-keepalive-requests", 0, "Close a connection after it has served this many requests; 0 means unlimited")
+	fs.BoolVar(&cfg.reusePort, "reuseport", false, "Listen with SO_REUSEPORT, so another server process can bind the same ports (e.g. during an upgrade)")
+	fs.DurationVar(&cfg.tcpKeepAlive, "tcp-keepalive", 0, "TCP keep-alive probe period for accepted connections; 0 uses the Go default (15s), negative disables probes")
+
+	fs.Float64Var(&cfg.rateLimit, "rate-limit", 0, "Maximum requests per second over all clients; excess requests get 429; 0 means unlimited")
+	fs.IntVar(&cfg.rateBurst, "rate-burst", 1, "Burst size (token bucket capacity) for -rate-limit")
+	fs.Float64Var(&cfg.clientRateLimit, "client-rate-limit", 0, "Maximum requests per second per client IP; excess requests get 429; 0 means unlimited")
+	fs.IntVar(&cfg.clientRateBurst, "client-rate-burst", 1, "Burst size (token bucket capacity) for -client-rate-limit")
+
+	responseBandwidth := fs.String("response-bandwidth", "", "Throttle response bodies to this rate (e.g. 100kb/s); requests can override it with ?bandwidth=")
+
+	fs.Float64Var(&cfg.behavior.chaos.rate, "chaos-rate", 0, "Fraction (0-1) of requests whose connection is broken on purpose (see -chaos-modes)")
+	chaosModes := fs.String("chaos-modes", strings.Join(chaosModes, ","), "Comma-separated ways to break connections, picked at random: reset, close, malformed, stall")
+
+	maxBodySize := fs.String("max-body-size", "0", "Largest request body accepted (e.g. 10mb); bigger ones get 413; 0 means unlimited")
+	fs.BoolVar(&cfg.validateJSON, "validate-json", false, "Refuse requests with a JSON Content-Type whose body is not valid JSON with 400")
+	fs.BoolVar(&cfg.problemJSON, "problem-json", false, "Send injected and plain-text errors as RFC 9457 application/problem+json bodies with the request ID")
+	var allowCIDRs, denyCIDRs []string
+	fs.Func("allow-cidr", "Only serve clients whose IP is in these comma-separated CIDR blocks or addresses, answering 403 to the others; repeatable", func(s string) error {
+		allowCIDRs = append(allowCIDRs, s)
+		return nil
+	})
+	fs.Func("deny-cidr", "Answer 403 to clients whose IP is in these comma-separated CIDR blocks or addresses, even if -allow-cidr lets them in; repeatable", func(s string) error {
+		denyCIDRs = append(denyCIDRs, s)
+		return nil
+	})
+	fs.StringVar(&cfg.expectContinue, "expect-continue", continueSend, "Handling of Expect: 100-continue: send (100 Continue when the body is read), delay (send it after -expect-continue-delay), reject (answer -expect-continue-status without reading the body) or fail (417)")
+	fs.DurationVar(&cfg.expectContinueDelay, "expect-continue-delay", time.Second, "How long -expect-continue=delay holds back the 100 Continue")
+	fs.IntVar(&cfg.expectContinueStatus, "expect-continue-status", http.StatusRequestEntityTooLarge, "Status sent by -expect-continue=reject")
+
+	fs.IntVar(&cfg.maxConcurrent, "max-concurrent", 0, "Maximum requests handled at once; 0 means unlimited")
+	fs.IntVar(&cfg.queueSize, "queue-size", 0, "Requests that may wait for a -max-concurrent slot; the rest get 503")
+	fs.DurationVar(&cfg.queueTimeout, "queue-timeout", time.Second, "How long a queued request waits for a slot before getting 503; 0 waits until the client gives up")
+	fs.DurationVar(&cfg.requestTimeout, "request-timeout", 0, "Deadline for handling a request, queueing included; requests past it get 503, or have their response cut short if it has started; 0 means none")
+
+	fs.StringVar(&cfg.compress, "compress", "", "Compress responses with these encodings, in order of preference (e.g. br,gzip); empty disables compression")
+	compressMinSize := fs.String("compress-min-size", "1kb", "Smallest response body that gets compressed")
+	fs.IntVar(&cfg.compressLevel, "compress-level", -1, "Compression level from 1 (fastest) to 9 (smallest); -1 uses each encoder's default")
+
+	fs.StringVar(&cfg.tlsCert, "tls-cert", "", "PEM certificate file; enables HTTPS together with -tls-key")
+	fs.StringVar(&cfg.tlsKey, "tls-key", "", "PEM private key file for -tls-cert")
+	fs.BoolVar(&cfg.tlsSelfSigned, "tls-self-signed", false, "Enable HTTPS with a self-signed certificate generated at startup")
+	fs.StringVar(&cfg.tlsAddr, "tls-addr", "", "Serve HTTPS on this address and keep plain HTTP on the main address")
+	fs.StringVar(&cfg.clientCA, "client-ca", "", "PEM CA bundle used to verify client certificates (mTLS)")
+	fs.BoolVar(&cfg.requireClientCert, "require-client-cert", false, "Reject TLS handshakes without a valid client certificate; needs -client-ca")
+	fs.BoolVar(&cfg.http3, "http3", false, "Also serve HTTP/3 over QUIC (UDP) and advertise it with Alt-Svc; needs TLS")
+	fs.StringVar(&cfg.http3Addr, "http3-addr", "", "UDP address for HTTP/3; defaults to the HTTPS address")
+
+	fs.DurationVar(&cfg.behavior.delay.base, "delay", 0, "Artificial latency added to each response (e.g. 50ms)")
+	fs.StringVar(&cfg.behavior.delay.dist, "delay-distribution", distFixed, "Delay distribution: fixed, uniform, normal, exponential or pareto")
+	fs.DurationVar(&cfg.behavior.delay.stddev, "delay-stddev", 0, "Spread of the uniform (delay±stddev) and normal delay distributions")
+	fs.DurationVar(&cfg.behavior.delay.max, "delay-max", 0, "Upper bound for any sampled delay; 0 means unbounded")
+	fs.Float64Var(&cfg.behavior.delay.alpha, "delay-pareto-alpha", 1.5, "Shape of the pareto delay distribution; smaller means a heavier tail")
+
+	fs.Float64Var(&cfg.behavior.errors.rate, "error-rate", 0, "Fraction (0-1) of responses replaced by an injected error")
+	errorCodes := fs.String("error-codes", "500", "Comma-separated status codes to choose from for injected errors")
+	errorBody := fs.String("error-body", defaultErrorBody, "Body sent with injected errors; empty for none")
+
+	fs.Float64Var(&cfg.behavior.leak.rate, "leak-rate", 0, "Fraction (0-1) of requests that deliberately leak a goroutine or connection (see -leak-mode)")
+	fs.StringVar(&cfg.behavior.leak.mode, "leak-mode", leakGoroutine, "What leaking requests leak: goroutine, or connection (the response is sent and the connection is never closed)")
+
+	fs.DurationVar(&cfg.degradeEvery, "degrade-every", 0, "Enter a degraded phase this often (e.g. 10m), to simulate deploys; 0 disables")
+	fs.DurationVar(&cfg.degradeFor, "degrade-for", 30*time.Second, "Length of each degraded phase")
+	fs.DurationVar(&cfg.degradeDelay, "degrade-delay", 0, "Extra latency added to every response during a degraded phase")
+	fs.IntVar(&cfg.degradeStatus, "degrade-status", 0, "Status every response fails with during a degraded phase (e.g. 503); 0 only adds -degrade-delay")
+
+	fs.DurationVar(&cfg.rampRate, "ramp-rate", 0, "Latency added every -ramp-interval over the server's lifetime (e.g. 1ms), to test trend detection; 0 disables")
+	fs.DurationVar(&cfg.rampInterval, "ramp-interval", time.Minute, "Period over which -ramp-rate is added")
+	rampMode := fs.String("ramp-mode", "linear", "How the latency ramp grows: linear, or exponential (multiplied by -ramp-factor every -ramp-interval)")
+	fs.Float64Var(&cfg.rampFactor, "ramp-factor", 2, "Growth factor per -ramp-interval of the exponential latency ramp")
+	fs.DurationVar(&cfg.rampMax, "ramp-max", time.Minute, "Cap on the latency added by the ramp; 0 means no cap")
+
+	responseSize := fs.String("response-size", "", "Send a generated payload of this size instead of the JSON body; a single size (4kb) or a range (1kb..1mb)")
+	fs.Uint64Var(&cfg.payloadSeed, "payload-seed", 1, "Seed for the generated payload contents")
+
+	fs.BoolVar(&cfg.etags, "etag", true, "Send ETag headers and answer matching If-None-Match requests with 304")
+	fs.BoolVar(&cfg.lastModified, "last-modified", true, "Send Last-Modified (the server start time) and answer If-Modified-Since requests with 304")
+	fs.StringVar(&cfg.cacheControl, "cache-control", "", "Cache-Control header for successful mock responses (e.g. \"public, max-age=60\"); empty sends none")
+	fs.DurationVar(&cfg.responseCacheTTL, "response-cache-ttl", 0, "Serve repeated GET requests (same path, query and Accept header) from an in-memory cache for this long, skipping delays and errors, to model a cache in front of a slow backend; 0 disables it")
+	fs.IntVar(&cfg.responseCacheSize, "response-cache-size", 1000, "Most responses kept by -response-cache-ttl; the least recently used are evicted")
+
+	fs.DurationVar(&cfg.slowDelay, "slow-delay", time.Second, "Delay applied by the /slow route")
+	fs.IntVar(&cfg.errorStatus, "error-status", http.StatusInternalServerError, "Status code returned by the /error route")
+	randomDelay := fs.String("random-delay", "0..500ms", "Delay range for the /random route")
+	randomSize := fs.String("random-size", "1b..64kb", "Payload size range for the /random route")
+	largeSize := fs.String("large-size", "1mb", "Payload size for the /large route")
+	fs.StringVar(&cfg.saveUploads, "save-uploads", "", "Keep the parts received by /upload in this directory instead of discarding them")
+	fs.DurationVar(&cfg.pollInterval, "poll-interval", 5*time.Second, "How often new data becomes available to /poll requests")
+	fs.DurationVar(&cfg.pollTimeout, "poll-timeout", 30*time.Second, "How long /poll holds a request without data before answering 204")
+	fs.DurationVar(&cfg.maxBurn, "max-burn", 5*time.Second, "Longest CPU burn a /burn request may ask for")
+	maxAlloc := fs.String("max-alloc", "512mb", "Most memory held by /alloc requests at once")
+	echoMaxBody := fs.String("echo-max-body", "64kb", "Maximum number of request body bytes reflected by /echo")
+
+	fs.StringVar(&cfg.authCredentials, "auth-credentials", "user:password", "user:password accepted by /auth/basic and /login")
+	fs.StringVar(&cfg.authAPIKeyHeader, "auth-api-key-header", "X-API-Key", "Header checked by /auth/api-key")
+	fs.StringVar(&cfg.authAPIKey, "auth-api-key", "test-key", "API key accepted by /auth/api-key")
+	fs.StringVar(&cfg.authToken, "auth-token", "", "Static bearer token accepted by /auth/bearer in addition to tokens from /login")
+	fs.DurationVar(&cfg.authTokenTTL, "auth-token-ttl", time.Hour, "Lifetime of the tokens issued by /login")
+
+	fs.StringVar(&cfg.staticDir, "static-dir", "", "Serve the files in this directory under -static-prefix")
+	fs.StringVar(&cfg.staticPrefix, "static-prefix", "/static/", "URL path prefix for -static-dir")
+
+	upstream := fs.String("upstream", "", "Proxy requests to the catch-all route to this backend (e.g. http://real-api:8080) instead of sending the mock response; delays, errors and limits still apply")
+	mirror := fs.String("mirror", "", "In -upstream mode, also send a copy of requests to this shadow backend and discard its responses")
+	fs.Float64Var(&cfg.mirrorRate, "mirror-rate", 1, "Fraction (0-1) of proxied requests copied to -mirror")
+	fs.DurationVar(&cfg.mirrorTimeout, "mirror-timeout", 10*time.Second, "Timeout for requests sent to -mirror")
+
+	fs.StringVar(&cfg.mocksFile, "mocks", "", "YAML file of stub definitions (request matchers and responses) served before the built-in routes")
+	fs.StringVar(&cfg.graphqlFile, "graphql", "", "YAML file of stubbed GraphQL operations and an optional schema served on /graphql")
+	fs.StringVar(&cfg.openAPISpec, "openapi", "", "Validate requests against this OpenAPI 3 spec (YAML or JSON) and reject the ones that do not follow it")
+	fs.DurationVar(&cfg.mocksPoll, "mocks-poll", 2*time.Second, "How often to check the -mocks file for changes")
+
+	fs.IntVar(&cfg.recordRequests, "record-requests", 0, "Keep this many requests carrying an X-Mgc-Test-Id header for /requests; 0 disables recording")
+	fs.IntVar(&cfg.inspectSize, "inspect-size", 0, "Number of recent requests shown by /__inspect; 0 disables it")
+	fs.DurationVar(&cfg.statsWindow, "stats-window", 0, "Keep per-second request counts and latencies this long for /stats; 0 disables")
+	fs.IntVar(&cfg.clientStats, "client-stats", 0, "Track requests and latencies of up to this many client IPs for /stats/clients and the client metrics; 0 disables")
+	fs.BoolVar(&cfg.serverTiming, "server-timing", true, "Add a Server-Timing header with the server's processing time and the injected delay to every response")
+	otlpEndpoint := fs.String("otlp-endpoint", "", "Trace requests with OpenTelemetry and export the spans to this OTLP/HTTP collector (e.g. http://localhost:4318); empty disables tracing")
+	fs.Float64Var(&cfg.traceSampleRate, "trace-sample-rate", 1, "Fraction (0-1) of traces sampled when the request carries no sampling decision in its traceparent header")
+	inspectMaxBody := fs.String("inspect-max-body", "4kb", "Maximum number of request body bytes kept for /__inspect")
+
+	fs.StringVar(&cfg.grpcAddr, "grpc-addr", "", "Also serve the mock gRPC service (mock.v1.Mock) in plaintext on this address (e.g. :9090)")
+	fs.StringVar(&cfg.tcpEchoAddr, "tcp-echo", "", "Also run a raw TCP echo listener on this address (e.g. :9000)")
+	fs.StringVar(&cfg.udpEchoAddr, "udp-echo", "", "Also run a raw UDP echo listener on this address (e.g. :9001)")
+
+	fs.StringVar(&cfg.adminAddr, "admin-addr", "", "Serve the admin API on this separate address instead of under /admin/ on the main listener")
+	fs.BoolVar(&cfg.enablePprof, "enable-pprof", false, "Serve pprof and expvar under /debug/ on the main listener (always on with -admin-addr)")
+	fs.BoolVar(&cfg.showVersion, "version", false, "Print the version, commit and Go version of the server and exit")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if cfg.showVersion {
+		return cfg, nil
+	}
+
+	var err error
+	cfg.cmdLine = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { cfg.cmdLine[f.Name] = true })
+	var routeDefs []map[string]string
+	if cfg.configFile != "" {
+		if routeDefs, err = applyConfigFile(fs, cfg.configFile, cfg.cmdLine); err != nil {
+			return nil, fmt.Errorf("-config: %v", err)
+		}
+	}
+	if cfg.readyFormat != "text" && cfg.readyFormat != "json" {
+		return nil, fmt.Errorf("invalid -ready-format %q (want text or json)", cfg.readyFormat)
+	}
+	if cfg.port < 0 || cfg.port > 65535 {
+		return nil, fmt.Errorf("invalid -port %d (want 0-65535)", cfg.port)
+	}
+	if cfg.readyFD < 0 {
+		return nil, errors.New("-ready-fd must not be negative")
+	}
+	if cfg.logSample < 0 || cfg.logSample > 1 {
+		return nil, fmt.Errorf("-log-sample must be between 0 and 1, got %v", cfg.logSample)
+	}
+	if cfg.logKeepSlow < 0 {
+		return nil, errors.New("-log-keep-slow must not be negative")
+	}
+	if cfg.metricsBuckets, err = parseBuckets(*metricsBuckets); err != nil {
+		return nil, fmt.Errorf("invalid -metrics-buckets: %v", err)
+	}
+	if cfg.metricsNativeFactor != 0 && cfg.metricsNativeFactor <= 1 {
+		return nil, fmt.Errorf("-metrics-native-histogram must be greater than 1, got %v", cfg.metricsNativeFactor)
+	}
+	switch cfg.metricsDuration {
+	case "histogram", "summary", "both":
+	default:
+		return nil, fmt.Errorf("unknown -metrics-duration %q (want histogram, summary or both)", cfg.metricsDuration)
+	}
+	if cfg.metricsObjectives, err = parseQuantiles(*metricsQuantiles); err != nil {
+		return nil, fmt.Errorf("invalid -metrics-quantiles: %v", err)
+	}
+	if cfg.metricsRoutes < 0 {
+		return nil, errors.New("-metrics-routes must not be negative")
+	}
+	cfg.metricsSkipPaths = splitList(*metricsSkipPaths)
+	cfg.metricsSkipMethods = splitList(*metricsSkipMethods)
+	if cfg.metricsLabels, err = parseLabels(*metricsLabels); err != nil {
+		return nil, fmt.Errorf("invalid -metrics-labels: %v", err)
+	}
+	if cfg.metricsHeaderLabels, err = parseHeaderLabels(*metricsHeaderLabels); err != nil {
+		return nil, fmt.Errorf("invalid -metrics-header-labels: %v", err)
+	}
+	if cfg.metricsHeaderValues < 1 {
+		return nil, errors.New("-metrics-header-values must be at least 1")
+	}
+	if cfg.rateLimit < 0 || cfg.clientRateLimit < 0 {
+		return nil, errors.New("rate limits must not be negative")
+	}
+	if cfg.behavior.chaos.modes, err = parseChaosModes(*chaosModes); err != nil {
+		return nil, fmt.Errorf("invalid -chaos-modes: %v", err)
+	}
+	if cfg.unixOnly && cfg.unixSocket == "" {
+		return nil, errors.New("-unix-only needs -unix")
+	}
+	if cfg.statsWindow != 0 && cfg.statsWindow < time.Second {
+		return nil, errors.New("-stats-window must be at least 1s, or 0 to disable")
+	}
+	if cfg.mocksPoll <= 0 {
+		return nil, errors.New("-mocks-poll must be positive")
+	}
+	if cfg.recordRequests < 0 || cfg.inspectSize < 0 || cfg.clientStats < 0 {
+		return nil, errors.New("-record-requests, -inspect-size and -client-stats must not be negative")
+	}
+	if cfg.responseCacheTTL < 0 || cfg.responseCacheSize <= 0 {
+		return nil, errors.New("-response-cache-ttl must not be negative and -response-cache-size must be positive")
+	}
+	if cfg.requestTimeout < 0 {
+		return nil, errors.New("-request-timeout must not be negative")
+	}
+	if cfg.maxConcurrent < 0 || cfg.queueSize < 0 {
+		return nil, errors.New("-max-concurrent and -queue-size must not be negative")
+	}
+	switch *accessLogFormat {
+	case "common":
+	case "combined":
+		cfg.accessLogCombined = true
+	default:
+		return nil, fmt.Errorf("invalid -access-log-format %q (want common or combined)", *accessLogFormat)
+	}
+	if *accessLogMaxSize != "" {
+		if cfg.accessLogMaxSize, err = parseSizeUpTo(*accessLogMaxSize, math.MaxInt64); err != nil {
+			return nil, fmt.Errorf("invalid -access-log-max-size: %v", err)
+		}
+	}
+	codes, err := parseStatusCodes(*errorCodes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -error-codes: %v", err)
+	}
+	cfg.behavior.errors.codes = codes
+	cfg.behavior.errors.body = []byte(*errorBody)
+	if cfg.behavior.responseSize, err = parseSizeRange(*responseSize); err != nil {
+		return nil, fmt.Errorf("invalid -response-size: %v", err)
+	}
+	if err := cfg.behavior.validate(); err != nil {
+		return nil, err
+	}
+	// Listeners inherit the behaviour flags, so they are parsed after them.
+	for _, spec := range listenSpecs {
+		l, err := parseListenerSpec(spec, cfg.behavior)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -listen %q: %v", spec, err)
+		}
+		cfg.listeners = append(cfg.listeners, l)
+	}
+	for _, def := range routeDefs {
+		rt, err := parseRouteSpec(def, cfg.behavior)
+		if err != nil {
+			return nil, fmt.Errorf("-config: route %q: %v", def["path"], err)
+		}
+		cfg.routes = append(cfg.routes, rt)
+	}
+	seenTenants := make(map[string]bool)
+	for _, spec := range tenantSpecs {
+		t, err := parseTenantSpec(spec, cfg.behavior)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -tenant %q: %v", spec, err)
+		}
+		if seenTenants[t.key] {
+			return nil, fmt.Errorf("duplicate -tenant %q", t.key)
+		}
+		seenTenants[t.key] = true
+		cfg.tenants = append(cfg.tenants, t)
+	}
+	if cfg.randomDelay, err = parseDurationRange(*randomDelay); err != nil {
+		return nil, fmt.Errorf("invalid -random-delay: %v", err)
+	}
+	if cfg.randomSize, err = parseSizeRange(*randomSize); err != nil {
+		return nil, fmt.Errorf("invalid -random-size: %v", err)
+	}
+	if cfg.compressMinSize, err = parseSize(*compressMinSize); err != nil {
+		return nil, fmt.Errorf("invalid -compress-min-size: %v", err)
+	}
+	if *responseBandwidth != "" {
+		if cfg.responseBandwidth, err = parseBandwidth(*responseBandwidth); err != nil {
+			return nil, fmt.Errorf("invalid -response-bandwidth: %v", err)
+		}
+	}
+	if cfg.maxBodySize, err = parseSize(*maxBodySize); err != nil {
+		return nil, fmt.Errorf("invalid -max-body-size: %v", err)
+	}
+	if len(allowCIDRs) > 0 || len(denyCIDRs) > 0 {
+		cfg.ipFilter = &ipFilter{}
+		if cfg.ipFilter.allow, err = parseCIDRs(strings.Join(allowCIDRs, ",")); err != nil {
+			return nil, fmt.Errorf("invalid -allow-cidr: %v", err)
+		}
+		if cfg.ipFilter.deny, err = parseCIDRs(strings.Join(denyCIDRs, ",")); err != nil {
+			return nil, fmt.Errorf("invalid -deny-cidr: %v", err)
+		}
+	}
+	if err := validateContinueMode(cfg.expectContinue); err != nil {
+		return nil, fmt.Errorf("invalid -expect-continue: %v", err)
+	}
+	if cfg.expectContinueStatus < 400 || cfg.expectContinueStatus > 599 {
+		return nil, fmt.Errorf("-expect-continue-status must be a 4xx or 5xx status, got %d", cfg.expectContinueStatus)
+	}
+	if cfg.largeSize, err = parseSize(*largeSize); err != nil {
+		return nil, fmt.Errorf("invalid -large-size: %v", err)
+	}
+	if cfg.echoMaxBody, err = parseSize(*echoMaxBody); err != nil {
+		return nil, fmt.Errorf("invalid -echo-max-body: %v", err)
+	}
+	if cfg.maxAlloc, err = parseSize(*maxAlloc); err != nil {
+		return nil, fmt.Errorf("invalid -max-alloc: %v", err)
+	}
+	if cfg.inspectMaxBody, err = parseSize(*inspectMaxBody); err != nil {
+		return nil, fmt.Errorf("invalid -inspect-max-body: %v", err)
+	}
+	if cfg.pollInterval <= 0 {
+		return nil, errors.New("-poll-interval must be positive")
+	}
+	if cfg.pollTimeout <= 0 || cfg.pollTimeout > maxPollTimeout {
+		return nil, fmt.Errorf("-poll-timeout must be positive and at most %v", maxPollTimeout)
+	}
+	if user, _, ok := strings.Cut(cfg.authCredentials, ":"); !ok || user == "" {
+		return nil, fmt.Errorf("invalid -auth-credentials %q (want user:password)", cfg.authCredentials)
+	}
+	if cfg.saveUploads != "" {
+		if fi, err := os.Stat(cfg.saveUploads); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("-save-uploads %q is not a directory", cfg.saveUploads)
+		}
+	}
+	if cfg.staticDir != "" {
+		if fi, err := os.Stat(cfg.staticDir); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("-static-dir %q is not a directory", cfg.staticDir)
+		}
+		if !strings.HasPrefix(cfg.staticPrefix, "/") || !strings.HasSuffix(cfg.staticPrefix, "/") {
+			return nil, errors.New("-static-prefix must start and end with /")
+		}
+	}
+	if *upstream != "" {
+		if cfg.upstream, err = parseUpstream(*upstream); err != nil {
+			return nil, fmt.Errorf("invalid -upstream: %v", err)
+		}
+	}
+	if *mirror != "" {
+		if cfg.upstream == nil {
+			return nil, errors.New("-mirror needs -upstream")
+		}
+		if cfg.mirror, err = parseUpstream(*mirror); err != nil {
+			return nil, fmt.Errorf("invalid -mirror: %v", err)
+		}
+	}
+	if cfg.mirrorRate < 0 || cfg.mirrorRate > 1 {
+		return nil, fmt.Errorf("-mirror-rate must be between 0 and 1, got %v", cfg.mirrorRate)
+	}
+	if *otlpEndpoint != "" {
+		if cfg.otlpEndpoint, err = tracesEndpoint(*otlpEndpoint); err != nil {
+			return nil, fmt.Errorf("invalid -otlp-endpoint: %v", err)
+		}
+	}
+	if cfg.traceSampleRate < 0 || cfg.traceSampleRate > 1 {
+		return nil, fmt.Errorf("-trace-sample-rate must be between 0 and 1, got %v", cfg.traceSampleRate)
+	}
+	switch cfg.metricsBackend {
+	case "prometheus", "statsd":
+	case "otel":
+		if cfg.otlpEndpoint == "" {
+			return nil, errors.New("-metrics-backend=otel needs -otlp-endpoint")
+		}
+	default:
+		return nil, fmt.Errorf("unknown -metrics-backend %q (want prometheus, otel or statsd)", cfg.metricsBackend)
+	}
+	switch *rampMode {
+	case "linear":
+	case "exponential":
+		cfg.rampExponential = true
+		if cfg.rampFactor <= 1 {
+			return nil, errors.New("-ramp-factor must be greater than 1")
+		}
+	default:
+		return nil, fmt.Errorf("invalid -ramp-mode %q (want linear or exponential)", *rampMode)
+	}
+	if cfg.rampInterval <= 0 {
+		return nil, errors.New("-ramp-interval must be positive")
+	}
+	if cfg.degradeEvery > 0 {
+		if cfg.degradeFor <= 0 || cfg.degradeFor >= cfg.degradeEvery {
+			return nil, errors.New("-degrade-for must be positive and shorter than -degrade-every")
+		}
+		if cfg.degradeStatus != 0 && (cfg.degradeStatus < 400 || cfg.degradeStatus > 599) {
+			return nil, fmt.Errorf("invalid -degrade-status %d (want 400-599)", cfg.degradeStatus)
+		}
+	}
+	if cfg.errorStatus < 100 || cfg.errorStatus > 599 {
+		return nil, fmt.Errorf("invalid -error-status %d", cfg.errorStatus)
+	}
+	return cfg, nil
+}
+
+// listenAddr returns the address the server should listen on.
+func (c *config) listenAddr() string {
+	if c.addr != "" {
+		return c.addr
+	}
+	return net.JoinHostPort(c.host, strconv.Itoa(c.port))
+}
+
+// httpServer returns an http.Server for addr with the configured timeouts,
+// limits and connection settings.
+func (c *config) httpServer(addr string, handler http.Handler) *http.Server {
+	hs := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       c.readTimeout,
+		ReadHeaderTimeout: c.readHeaderTimeout,
+		WriteTimeout:      c.writeTimeout,
+		IdleTimeout:       c.idleTimeout,
+		MaxHeaderBytes:    c.maxHeaderBytes,
+		ConnContext:       connContext,
+		ConnState:         metrics.ConnState,
+	}
+	hs.SetKeepAlivesEnabled(!c.disableKeepAlive)
+	if c.h2c {
+		// Unset Protocols means HTTP/1 plus HTTP/2 over TLS; keep those and
+		// add HTTP/2 without TLS.
+		hs.Protocols = new(http.Protocols)
+		hs.Protocols.SetHTTP1(true)
+		hs.Protocols.SetHTTP2(true)
+		hs.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return hs
+}
+
+// httpService wraps httpServer in a service that listens with the configured
+// TCP keep-alive period.
+func (c *config) httpService(addr string, handler http.Handler) *httpService {
+	return &httpService{
+		Server:  c.httpServer(addr, handler),
+		network: "tcp",
+		lc:      c.listenConfig(),
+	}
+}
+
+// listenConfig returns the settings for TCP listeners: the keep-alive
+// period and, with -reuseport, SO_REUSEPORT.
+func (c *config) listenConfig() net.ListenConfig {
+	lc := net.ListenConfig{KeepAlive: c.tcpKeepAlive}
+	if c.reusePort {
+		lc.Control = reusePort
+	}
+	return lc
+}
+
+// unixService is like httpService for a unix socket at path. The socket
+// file is removed when the service shuts down.
+func (c *config) unixService(path string, handler http.Handler) *httpService {
+	return &httpService{Server: c.httpServer(path, handler), network: "unix"}
+}
+
+// envString returns the value of the environment variable key, or def if it
+// is unset or empty.
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt is like envString for integers. Unparseable values are ignored.
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,212 @@
+package mockserver
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// A -config file sets flags by name, so everything the command line can do
+// can be kept in a file, plus per-route behaviour, e.g.
+//
+//	port: 8080
+//	delay: 20ms
+//	error-rate: 0.01
+//	error-codes: [500, 503]
+//	tls-self-signed: true
+//	max-concurrent: 200
+//	listen:
+//	  - ":8081?name=slow&delay=500ms"
+//	routes:
+//	  - path: GET /api/users/{id}
+//	    name: users
+//	    delay: 50ms
+//	    response-size: 1kb..4kb
+//	  - path: GET /api/search
+//	    fanout: max
+//	    downstream:
+//	      - name=index&calls=20&delay=10ms&delay-distribution=pareto
+//	      - name=db&delay=5ms&error-rate=0.01
+//
+// Lists set repeatable flags (listen, tenant, ...) once per element and are
+// joined with commas for the others, and with semicolons for the downstream
+// calls of a route. Flags given on the command line take
+// precedence over the file; anything unset keeps its default.
+
+// routeSpec is a route from the -config file: a ServeMux pattern served by
+// the mock handler with its own behaviour.
+type routeSpec struct {
+	name     string
+	pattern  string
+	behavior behavior
+}
+
+// configSetting is a flag set by the -config file.
+type configSetting struct {
+	key    string
+	values []string
+	line   int
+}
+
+// readConfigFile parses the -config file at path into its flag settings and
+// raw route definitions, checking that every setting names a flag of fs.
+func readConfigFile(fs *flag.FlagSet, path string) ([]configSetting, []map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("%s: the top level must be a mapping of flag names to values", path)
+	}
+
+	var settings []configSetting
+	var routes []map[string]string
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i].Value, root.Content[i+1]
+		if key == "routes" {
+			if routes, err = parseRouteNodes(value); err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: routes: %w", path, value.Line, err)
+			}
+			continue
+		}
+		if fs.Lookup(key) == nil || key == "config" {
+			return nil, nil, fmt.Errorf("%s:%d: unknown setting %q", path, root.Content[i].Line, key)
+		}
+		values, err := scalarValues(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %s: %w", path, value.Line, key, err)
+		}
+		settings = append(settings, configSetting{key: key, values: values, line: value.Line})
+	}
+	return settings, routes, nil
+}
+
+// applyConfigFile sets every flag of fs named in the file at path that is not
+// in cmdLine, the flags given on the command line, and returns the raw route
+// definitions, which need the final behaviour flags to be parsed.
+func applyConfigFile(fs *flag.FlagSet, path string, cmdLine map[string]bool) ([]map[string]string, error) {
+	settings, routes, err := readConfigFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range settings {
+		if cmdLine[st.key] {
+			continue
+		}
+		values := st.values
+		// Typed flags keep only the last value they are set to, so lists
+		// are joined for them; flag.Func flags collect every value.
+		if _, typed := fs.Lookup(st.key).Value.(flag.Getter); typed && len(values) > 1 {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, v := range values {
+			if err := fs.Set(st.key, v); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid value %q for %s: %w", path, st.line, v, st.key, err)
+			}
+		}
+	}
+	return routes, nil
+}
+
+// scalarValues returns the value of a scalar node, or the elements of a list
+// of scalars.
+func scalarValues(n *yaml.Node) ([]string, error) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return []string{n.Value}, nil
+	case yaml.SequenceNode:
+		var out []string
+		for _, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, errors.New("want a value or a list of values")
+			}
+			out = append(out, item.Value)
+		}
+		return out, nil
+	}
+	return nil, errors.New("want a value or a list of values")
+}
+
+// parseRouteNodes flattens the routes list into option maps.
+func parseRouteNodes(n *yaml.Node) ([]map[string]string, error) {
+	if n.Kind != yaml.SequenceNode {
+		return nil, errors.New("want a list of routes")
+	}
+	var routes []map[string]string
+	for _, item := range n.Content {
+		if item.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: want a mapping", item.Line)
+		}
+		opts := make(map[string]string)
+		for i := 0; i < len(item.Content); i += 2 {
+			values, err := scalarValues(item.Content[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", item.Content[i].Line, item.Content[i].Value, err)
+			}
+			sep := ","
+			if item.Content[i].Value == "downstream" {
+				sep = ";"
+			}
+			opts[item.Content[i].Value] = strings.Join(values, sep)
+		}
+		routes = append(routes, opts)
+	}
+	return routes, nil
+}
+
+// parseRouteSpec builds a route from its options: path (the pattern), name
+// (the handler label in the metrics, by default the pattern), the behaviour
+// settings of -listen, and fanout and downstream (see fanoutModel). Unset
+// behaviour settings are inherited from base.
+func parseRouteSpec(opts map[string]string, base behavior) (routeSpec, error) {
+	rt := routeSpec{pattern: opts["path"], name: opts["name"], behavior: base}
+	if rt.pattern == "" {
+		return routeSpec{}, errors.New("missing path")
+	}
+	if rt.name == "" {
+		rt.name = rt.pattern
+	}
+	for key, v := range opts {
+		var err error
+		switch key {
+		case "path", "name":
+			continue
+		case "fanout":
+			rt.behavior.fanout.mode = v
+			continue
+		case "downstream":
+			if rt.behavior.fanout.calls, err = parseDownstream(v); err != nil {
+				return routeSpec{}, fmt.Errorf("downstream: %w", err)
+			}
+			continue
+		}
+		known, err := setBehaviorOption(&rt.behavior, key, v)
+		if !known {
+			return routeSpec{}, fmt.Errorf("unknown option %q", key)
+		}
+		if err != nil {
+			return routeSpec{}, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if rt.behavior.fanout.mode == "" && len(rt.behavior.fanout.calls) > 0 {
+		rt.behavior.fanout.mode = fanoutMax
+	}
+	if err := rt.behavior.validate(); err != nil {
+		return routeSpec{}, err
+	}
+	return rt, nil
+}
@@ -0,0 +1,44 @@
+package mockserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"server/metrics"
+)
+
+type connInfoKey struct{}
+
+// connInfo is per-connection state, attached to the context of every request
+// served on that connection.
+type connInfo struct {
+	// requests counts the requests started on the connection.
+	requests atomic.Int64
+}
+
+// connContext is used as http.Server.ConnContext.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	ctx = metrics.ConnContext(ctx, c)
+	return context.WithValue(ctx, connInfoKey{}, &connInfo{})
+}
+
+// connInfoFrom returns the connInfo of the connection serving ctx, or nil for
+// servers that do not set one (e.g. HTTP/3).
+func connInfoFrom(ctx context.Context) *connInfo {
+	ci, _ := ctx.Value(connInfoKey{}).(*connInfo)
+	return ci
+}
+
+// limitKeepAlive closes each connection once it has served max requests, by
+// asking the server to close it after the response. This simulates servers
+// and proxies that recycle keep-alive connections.
+func limitKeepAlive(max int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ci := connInfoFrom(r.Context()); ci != nil && ci.requests.Add(1) >= max {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
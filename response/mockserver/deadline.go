@@ -0,0 +1,116 @@
+package mockserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"server/metrics"
+)
+
+// errRequestDeadline is the cause of the context of a request that ran past
+// -request-timeout.
+var errRequestDeadline = errors.New("request deadline exceeded")
+
+// requestDeadline gives every request limit to be handled, queueing for the
+// rate and concurrency limits included, so that latency stays bounded when
+// the server is overloaded. The deadline is on the request context: handlers
+// give up at their next wait (injected delays, queues, upstream calls) and
+// anything they write afterwards is discarded. A request that has not started
+// its response by then gets 503; one that has is cut short. The 503 is sent
+// by deadlineResponse where there is one, so that the route's metrics and
+// access log see it.
+func requestDeadline(limit time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeoutCause(r.Context(), limit, errRequestDeadline)
+		defer cancel()
+		dw := &deadlineWriter{ResponseWriter: w, ctx: ctx}
+		next.ServeHTTP(dw, r.WithContext(context.WithValue(ctx, deadlineKey{}, dw)))
+		if context.Cause(ctx) != errRequestDeadline {
+			return
+		}
+		switch {
+		case dw.timedOut:
+			metrics.RequestTimeout("before_response")
+		case dw.wrote:
+			metrics.RequestTimeout("during_response")
+		default:
+			metrics.RequestTimeout("before_response")
+			writeDeadlineError(w)
+		}
+	})
+}
+
+// deadlineKey is the context key of the deadlineWriter of requestDeadline.
+type deadlineKey struct{}
+
+// deadlineResponse sends the 503 of requestDeadline from inside the route
+// middleware, for a request that ran past its deadline before starting its
+// response.
+func deadlineResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outer, ok := r.Context().Value(deadlineKey{}).(*deadlineWriter)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		dw := &deadlineWriter{ResponseWriter: w, ctx: r.Context()}
+		next.ServeHTTP(dw, r)
+		if dw.expired() && !dw.wrote && !outer.wrote {
+			// Let the 503 through the outer writer.
+			outer.timedOut = true
+			writeDeadlineError(w)
+		}
+	})
+}
+
+func writeDeadlineError(w http.ResponseWriter) {
+	writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": errRequestDeadline.Error()})
+}
+
+// deadlineWriter refuses writes once the request deadline has passed.
+type deadlineWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+	// wrote is set once the response has started.
+	wrote bool
+	// timedOut is set when the 503 for the deadline is being sent.
+	timedOut bool
+}
+
+func (dw *deadlineWriter) expired() bool {
+	return !dw.timedOut && context.Cause(dw.ctx) == errRequestDeadline
+}
+
+func (dw *deadlineWriter) WriteHeader(code int) {
+	if dw.expired() {
+		return
+	}
+	if code >= 200 {
+		dw.wrote = true
+	}
+	dw.ResponseWriter.WriteHeader(code)
+}
+
+func (dw *deadlineWriter) Write(b []byte) (int, error) {
+	if dw.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	dw.wrote = true
+	return dw.ResponseWriter.Write(b)
+}
+
+func (dw *deadlineWriter) Flush() {
+	if !dw.expired() {
+		http.NewResponseController(dw.ResponseWriter).Flush()
+	}
+}
+
+func (dw *deadlineWriter) Unwrap() http.ResponseWriter {
+	return dw.ResponseWriter
+}
@@ -0,0 +1,21 @@
+package mockserver
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+)
+
+// debugRoutes registers the runtime profiling (net/http/pprof) and expvar
+// endpoints under /debug/ on mux, so profiles can be captured during a load
+// run, e.g. with
+//
+//	go tool pprof http://localhost:8080/debug/pprof/profile?seconds=30
+func debugRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+}
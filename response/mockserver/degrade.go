@@ -0,0 +1,50 @@
+package mockserver
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"server/metrics"
+)
+
+// degradation puts the server into a degraded phase of length every period,
+// starting one period after startup, to simulate rolling deploys: during a
+// phase every response is delayed by delay more and, if status is set, fails
+// with it.
+type degradation struct {
+	every, length time.Duration
+	delay         time.Duration
+	status        int
+
+	active atomic.Bool
+}
+
+// newDegradation starts the schedule, or returns nil when every is 0.
+func newDegradation(every, length, delay time.Duration, status int) *degradation {
+	if every <= 0 {
+		return nil
+	}
+	d := &degradation{every: every, length: length, delay: delay, status: status}
+	go func() {
+		for range time.Tick(every) {
+			d.active.Store(true)
+			metrics.SetDegraded(true)
+			log.Printf("Entering degraded phase for %v", length)
+			time.Sleep(length)
+			d.active.Store(false)
+			metrics.SetDegraded(false)
+			log.Printf("Leaving degraded phase")
+		}
+	}()
+	return d
+}
+
+// now returns the extra delay and the failure status (0 for none) for a
+// request arriving now.
+func (d *degradation) now() (time.Duration, int) {
+	if d == nil || !d.active.Load() {
+		return 0, 0
+	}
+	return d.delay, d.status
+}
@@ -0,0 +1,182 @@
+package mockserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Supported values for -delay-distribution.
+const (
+	distFixed       = "fixed"
+	distUniform     = "uniform"
+	distNormal      = "normal"
+	distExponential = "exponential"
+	distPareto      = "pareto"
+)
+
+// delayModel describes how long the server waits before answering a request.
+// The zero value adds no delay.
+type delayModel struct {
+	// dist is one of the dist* constants.
+	dist string
+	// base is the fixed delay, the centre of the uniform and normal
+	// distributions, the mean of the exponential one and the minimum
+	// (scale) of the Pareto one.
+	base time.Duration
+	// stddev is the spread of the uniform (base±stddev) and normal
+	// distributions.
+	stddev time.Duration
+	// max caps every sampled delay; 0 means no cap.
+	max time.Duration
+	// alpha is the shape of the Pareto distribution. Smaller values give a
+	// heavier tail.
+	alpha float64
+}
+
+// validate checks that the model can be sampled.
+func (m delayModel) validate() error {
+	switch m.dist {
+	case distFixed, distUniform, distNormal, distExponential:
+	case distPareto:
+		if m.alpha <= 0 {
+			return fmt.Errorf("pareto shape must be positive, got %v", m.alpha)
+		}
+	default:
+		return fmt.Errorf("unknown delay distribution %q (want fixed, uniform, normal, exponential or pareto)", m.dist)
+	}
+	if m.base < 0 || m.stddev < 0 || m.max < 0 {
+		return fmt.Errorf("delays must not be negative")
+	}
+	return nil
+}
+
+// sample draws one delay from the model. The result is never negative and
+// never exceeds max when max is set.
+func (m delayModel) sample() time.Duration {
+	var d float64
+	base, stddev := float64(m.base), float64(m.stddev)
+	switch m.dist {
+	case distUniform:
+		d = base - stddev + rand.Float64()*2*stddev
+	case distNormal:
+		d = base + rand.NormFloat64()*stddev
+	case distExponential:
+		d = rand.ExpFloat64() * base
+	case distPareto:
+		// Inverse transform sampling: xm / U^(1/alpha), with U in (0, 1].
+		d = base / math.Pow(1-rand.Float64(), 1/m.alpha)
+	default:
+		d = base
+	}
+	if m.max > 0 && d > float64(m.max) {
+		d = float64(m.max)
+	}
+	return time.Duration(max(d, 0))
+}
+
+// sleepCtx waits for d or until ctx is done, whichever comes first, and
+// reports whether the full delay elapsed.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// injectDelay holds the request with context ctx for the injected delay d,
+// reporting it in the Server-Timing header and as a span, and reports
+// whether the full delay elapsed.
+func injectDelay(ctx context.Context, d time.Duration) bool {
+	addTiming(ctx, "delay", "injected delay", d)
+	if d <= 0 {
+		return true
+	}
+	ctx, span := tracer.Start(ctx, "injected delay")
+	defer span.End()
+	return sleepCtx(ctx, d)
+}
+
+// durationRange is a closed range of durations.
+type durationRange struct {
+	min, max time.Duration
+}
+
+// parseDurationRange parses either a single duration ("50ms") or a range
+// ("10ms..500ms").
+func parseDurationRange(s string) (durationRange, error) {
+	lo, hi, isRange := strings.Cut(s, "..")
+	from, err := time.ParseDuration(lo)
+	if err != nil {
+		return durationRange{}, err
+	}
+	if !isRange {
+		return durationRange{from, from}, nil
+	}
+	to, err := time.ParseDuration(hi)
+	if err != nil {
+		return durationRange{}, err
+	}
+	if from < 0 || to < from {
+		return durationRange{}, fmt.Errorf("invalid duration range %q", s)
+	}
+	return durationRange{from, to}, nil
+}
+
+// sample returns a duration drawn uniformly from the range.
+func (r durationRange) sample() time.Duration {
+	if r.max <= r.min {
+		return r.min
+	}
+	return r.min + rand.N(r.max-r.min+1)
+}
+
+// duration is a time.Duration that is written as, and parsed from, strings
+// like "50ms" in YAML and JSON documents.
+type duration time.Duration
+
+func (d duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
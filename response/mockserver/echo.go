@@ -0,0 +1,90 @@
+package mockserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+)
+
+// maxEchoDrain is how much of the request body beyond -echo-max-body /echo
+// reads to count it. Past that the connection is closed rather than drained.
+const maxEchoDrain = 64 << 20
+
+// echoResponse is the document returned by /echo.
+type echoResponse struct {
+	Method   string      `json:"method"`
+	Path     string      `json:"path"`
+	Proto    string      `json:"proto"`
+	Host     string      `json:"host"`
+	Query    url.Values  `json:"query"`
+	Headers  http.Header `json:"headers"`
+	ClientIP string      `json:"client_ip"`
+	// Body holds at most -echo-max-body bytes of the request body, base64
+	// encoded when it is not valid UTF-8.
+	Body         string `json:"body"`
+	BodyEncoding string `json:"body_encoding,omitempty"`
+	// BodySize is exact unless the body runs past maxEchoDrain, when it
+	// is a lower bound.
+	BodySize      int64 `json:"body_size"`
+	BodyTruncated bool  `json:"body_truncated,omitempty"`
+}
+
+// echoHandler describes the request it received as JSON, so clients can check
+// exactly what reached the server.
+func (s *server) echoHandler(w http.ResponseWriter, r *http.Request) {
+	resp := echoResponse{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Proto:    r.Proto,
+		Host:     r.Host,
+		Query:    r.URL.Query(),
+		Headers:  r.Header,
+		ClientIP: clientIP(r),
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.cfg.echoMaxBody))
+	if err == nil {
+		// Count whatever is left so the reported size is exact, up to a
+		// point.
+		var rest int64
+		rest, err = io.CopyN(io.Discard, r.Body, maxEchoDrain+1)
+		if err == io.EOF {
+			err = nil
+		}
+		if rest > maxEchoDrain {
+			w.Header().Set("Connection", "close")
+		}
+		resp.BodySize = int64(len(body)) + rest
+		resp.BodyTruncated = rest > 0
+	}
+	if bodyTooLarge(err) {
+		rejectBody(w, http.StatusRequestEntityTooLarge, "too_large", "request body too large")
+		return
+	}
+	if err != nil {
+		http.Error(w, "error reading request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if utf8.Valid(body) {
+		resp.Body = string(body)
+	} else {
+		resp.Body = base64.StdEncoding.EncodeToString(body)
+		resp.BodyEncoding = "base64"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// clientIP returns the IP address of the peer that sent r.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,75 @@
+package mockserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Supported values for -expect-continue.
+const (
+	continueSend   = "send"
+	continueDelay  = "delay"
+	continueReject = "reject"
+	continueFail   = "fail"
+)
+
+// expectContinue controls how requests with "Expect: 100-continue" are
+// answered. net/http sends the 100 Continue interim response the first time
+// the handler reads the body; this middleware can hold it back for a while,
+// reject the request with a final status before the client sends the body,
+// or refuse the expectation with 417. A request can pick its own behaviour
+// with ?continue= (or the x-inject-continue header): one of the modes, or a
+// duration to delay by.
+type expectContinue struct {
+	mode   string
+	delay  time.Duration
+	status int
+}
+
+// validateContinueMode checks a -expect-continue mode.
+func validateContinueMode(mode string) error {
+	switch mode {
+	case continueSend, continueDelay, continueReject, continueFail:
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q (want send, delay, reject or fail)", mode)
+}
+
+func (e *expectContinue) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Expect"), "100-continue") || controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mode, delay := e.mode, e.delay
+		if v := overrideValue(r, "continue"); v != "" {
+			if d, err := time.ParseDuration(v); err == nil && d >= 0 && d <= maxOverrideDelay {
+				mode, delay = continueDelay, d
+			} else if err := validateContinueMode(v); err == nil {
+				mode = v
+			} else {
+				http.Error(w, fmt.Sprintf("invalid continue %q (want send, delay, reject, fail or a duration up to %v)", v, maxOverrideDelay), http.StatusBadRequest)
+				return
+			}
+		}
+
+		switch mode {
+		case continueDelay:
+			if !sleepCtx(r.Context(), delay) {
+				return
+			}
+		case continueReject:
+			// Answering without reading the body makes net/http skip the
+			// 100 Continue and close the connection afterwards, since
+			// the client may still send the body.
+			http.Error(w, http.StatusText(e.status), e.status)
+			return
+		case continueFail:
+			http.Error(w, http.StatusText(http.StatusExpectationFailed), http.StatusExpectationFailed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
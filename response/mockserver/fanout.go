@@ -0,0 +1,167 @@
+package mockserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported values for the fanout route option.
+const (
+	fanoutMax = "max"
+	fanoutSum = "sum"
+)
+
+// fanoutModel simulates a handler that calls downstream services before
+// answering, so the tail latency amplification of fan-out can be studied: a
+// request that waits for 100 parallel calls is as slow as the slowest of
+// them. In a -config route,
+//
+//	routes:
+//	  - path: GET /search
+//	    fanout: max
+//	    downstream:
+//	      - name=index&calls=20&delay=10ms&delay-distribution=pareto
+//	      - name=db&delay=5ms&delay-distribution=exponential&error-rate=0.01&error-codes=503
+//
+// makes every request wait for 21 simulated calls. The zero value makes no
+// calls.
+type fanoutModel struct {
+	// mode is fanoutMax (the default) for calls made in parallel, where the
+	// request waits for the slowest one, or fanoutSum for calls made one
+	// after the other.
+	mode  string
+	calls []downstreamCall
+}
+
+// downstreamCall is one kind of simulated downstream call, made count times
+// per request.
+type downstreamCall struct {
+	// name reports the call in the Server-Timing header.
+	name   string
+	count  int
+	delay  delayModel
+	errors errorInjector
+}
+
+// parseDownstream parses a downstream option: call specs in query form (name,
+// calls, delay, delay-distribution, delay-stddev, delay-max,
+// delay-pareto-alpha, error-rate and error-codes) separated by semicolons.
+// Failed calls answer 502 unless error-codes says otherwise.
+func parseDownstream(s string) ([]downstreamCall, error) {
+	var calls []downstreamCall
+	for i, spec := range strings.Split(s, ";") {
+		c := downstreamCall{
+			name:   "downstream-" + strconv.Itoa(i+1),
+			count:  1,
+			delay:  delayModel{dist: distFixed, alpha: 1.5},
+			errors: errorInjector{codes: []int{http.StatusBadGateway}},
+		}
+		opts, err := url.ParseQuery(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %w", i+1, err)
+		}
+		for key, values := range opts {
+			v := values[len(values)-1]
+			switch key {
+			case "name":
+				c.name = v
+			case "calls":
+				c.count, err = strconv.Atoi(v)
+			case "delay":
+				c.delay.base, err = time.ParseDuration(v)
+			case "delay-distribution":
+				c.delay.dist = v
+			case "delay-stddev":
+				c.delay.stddev, err = time.ParseDuration(v)
+			case "delay-max":
+				c.delay.max, err = time.ParseDuration(v)
+			case "delay-pareto-alpha":
+				c.delay.alpha, err = strconv.ParseFloat(v, 64)
+			case "error-rate":
+				c.errors.rate, err = strconv.ParseFloat(v, 64)
+			case "error-codes":
+				c.errors.codes, err = parseStatusCodes(v)
+			default:
+				return nil, fmt.Errorf("call %d: unknown option %q", i+1, key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("call %d: %s: %w", i+1, key, err)
+			}
+		}
+		calls = append(calls, c)
+	}
+	return calls, nil
+}
+
+// validate checks the model can be sampled.
+func (f fanoutModel) validate() error {
+	if len(f.calls) == 0 {
+		if f.mode != "" {
+			return errors.New("fanout needs downstream calls")
+		}
+		return nil
+	}
+	if f.mode != fanoutMax && f.mode != fanoutSum {
+		return fmt.Errorf("unknown fanout mode %q (want max or sum)", f.mode)
+	}
+	for _, c := range f.calls {
+		if c.count < 1 {
+			return fmt.Errorf("%s: calls must be at least 1", c.name)
+		}
+		if err := c.delay.validate(); err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+		if err := c.errors.validate(); err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+	}
+	return nil
+}
+
+// sample draws the latency of every call and returns how long the request
+// waits for them, the status of the first failed call, or 0, and the time
+// spent on each kind of call for the Server-Timing header. In sum mode the
+// calls after a failure are not made; in max mode the request still waits
+// for the slowest call.
+func (f fanoutModel) sample() (total time.Duration, status int, spent []timingEntry) {
+	for _, c := range f.calls {
+		var d time.Duration
+		for range c.count {
+			call := c.delay.sample()
+			if f.mode == fanoutSum {
+				d += call
+			} else {
+				d = max(d, call)
+			}
+			if code, failed := c.errors.pick(); failed && status == 0 {
+				status = code
+				if f.mode == fanoutSum {
+					break
+				}
+			}
+		}
+		spent = append(spent, timingEntry{name: c.name, desc: c.desc(f.mode), dur: d})
+		if f.mode == fanoutSum {
+			total += d
+			if status != 0 {
+				break
+			}
+		} else {
+			total = max(total, d)
+		}
+	}
+	return total, status, spent
+}
+
+// desc describes c in the Server-Timing header, e.g. "20 calls (max)".
+func (c downstreamCall) desc(mode string) string {
+	if c.count == 1 {
+		return "downstream call"
+	}
+	return fmt.Sprintf("%d calls (%s)", c.count, mode)
+}
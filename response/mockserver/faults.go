@@ -0,0 +1,89 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultErrorBody is sent with injected errors unless -error-body says
+// otherwise.
+const defaultErrorBody = `{"status":"error","message":"injected error"}`
+
+// errorInjector makes a configurable fraction of responses fail with one of a
+// set of status codes.
+type errorInjector struct {
+	// rate is the probability (0-1) that a response is replaced by an error.
+	rate float64
+	// codes are the status codes to choose from, uniformly.
+	codes []int
+	// body is written with every injected error; it may be empty.
+	body []byte
+}
+
+// validate checks the injector settings.
+func (e errorInjector) validate() error {
+	if e.rate < 0 || e.rate > 1 {
+		return fmt.Errorf("error rate must be between 0 and 1, got %v", e.rate)
+	}
+	if e.rate > 0 && len(e.codes) == 0 {
+		return fmt.Errorf("error rate is set but no error codes were given")
+	}
+	for _, code := range e.codes {
+		if !validStatus(code) {
+			return fmt.Errorf("invalid error code %d", code)
+		}
+	}
+	return nil
+}
+
+// validStatus reports whether code can be sent as a response status.
+func validStatus(code int) bool {
+	return code >= 100 && code <= 599
+}
+
+// pick decides whether the current response should fail and with which code.
+func (e errorInjector) pick() (int, bool) {
+	if e.rate <= 0 || rand.Float64() >= e.rate {
+		return 0, false
+	}
+	return e.codes[rand.IntN(len(e.codes))], true
+}
+
+// write sends an injected error response to r with the given code, as
+// problem details when they are enabled.
+func (e errorInjector) write(w http.ResponseWriter, r *http.Request, code int) {
+	if problemsEnabled(r) {
+		writeProblem(w, r, code, problemInjected, "injected error")
+		return
+	}
+	if len(e.body) > 0 {
+		if json.Valid(e.body) {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+	}
+	w.WriteHeader(code)
+	w.Write(e.body)
+}
+
+// parseStatusCodes parses a comma-separated list of HTTP status codes.
+func parseStatusCodes(s string) ([]int, error) {
+	var codes []int
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		code, err := strconv.Atoi(f)
+		if err != nil || !validStatus(code) {
+			return nil, fmt.Errorf("invalid status code %q", f)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
@@ -0,0 +1,336 @@
+package mockserver
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+	"go.yaml.in/yaml/v3"
+)
+
+// graphqlFile is the document of a -graphql file:
+//
+//	schema: schema.graphql
+//	operations:
+//	  - operation: GetUser
+//	    delay: 20ms
+//	    data: {user: {id: "1", name: Ada}}
+//	  - field: search
+//	    errorRate: 0.1
+//	    status: 503
+type graphqlFile struct {
+	// Schema is an SDL file, relative to the -graphql file. With a schema,
+	// queries are validated and operations without a stub get fake data
+	// of the right shape.
+	Schema     string             `yaml:"schema"`
+	Operations []graphqlOperation `yaml:"operations"`
+}
+
+// graphqlOperation is a stubbed operation. It matches requests whose
+// operation is named Operation or whose first root field is Field, which
+// also works for anonymous operations.
+type graphqlOperation struct {
+	Operation string `yaml:"operation"`
+	Field     string `yaml:"field"`
+	// Data is returned as is; without it the data is generated from the
+	// schema.
+	Data   any            `yaml:"data"`
+	Errors []graphqlError `yaml:"errors"`
+	Delay  duration       `yaml:"delay"`
+	// ErrorRate is the fraction (0-1) of requests answered with an
+	// injected error instead.
+	ErrorRate float64 `yaml:"errorRate"`
+	// Status is the HTTP status of responses carrying errors (200 by
+	// default, as usual for GraphQL).
+	Status int `yaml:"status"`
+}
+
+type graphqlError struct {
+	Message    string         `yaml:"message" json:"message"`
+	Path       []any          `yaml:"path" json:"path,omitempty"`
+	Extensions map[string]any `yaml:"extensions" json:"extensions,omitempty"`
+}
+
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+type graphqlResponse struct {
+	Data   any            `json:"data"`
+	Errors []graphqlError `json:"errors,omitempty"`
+}
+
+// graphqlMock serves /graphql from the stubbed operations and the schema of
+// a -graphql file.
+type graphqlMock struct {
+	schema     *ast.Schema
+	operations []graphqlOperation
+}
+
+func loadGraphQL(path string) (*graphqlMock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f graphqlFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	m := &graphqlMock{operations: f.Operations}
+	for i, op := range f.Operations {
+		if op.Operation == "" && op.Field == "" {
+			return nil, fmt.Errorf("%s: operation %d needs an operation name or a field", path, i)
+		}
+		if op.ErrorRate < 0 || op.ErrorRate > 1 {
+			return nil, fmt.Errorf("%s: operation %d: errorRate must be between 0 and 1", path, i)
+		}
+		if op.Status != 0 && !validStatus(op.Status) {
+			return nil, fmt.Errorf("%s: operation %d: invalid status %d", path, i, op.Status)
+		}
+	}
+	if f.Schema != "" {
+		p := f.Schema
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(path), p)
+		}
+		sdl, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		if m.schema, err = gqlparser.LoadSchema(&ast.Source{Name: p, Input: string(sdl)}); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", p, err)
+		}
+	}
+	return m, nil
+}
+
+// graphqlHandler answers GraphQL queries sent as GET parameters or as a
+// JSON (or application/graphql) POST body.
+func (s *server) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	m := s.graphql
+	req, err := parseGraphQLRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, graphqlResponse{Errors: []graphqlError{{Message: err.Error()}}})
+		return
+	}
+	op, err := m.operation(req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, graphqlResponse{Errors: []graphqlError{{Message: err.Error()}}})
+		return
+	}
+
+	stub := m.match(op)
+	if stub == nil {
+		if m.schema == nil {
+			writeJSON(w, http.StatusOK, graphqlResponse{Errors: []graphqlError{{
+				Message: fmt.Sprintf("no stub matches operation %q and no schema is configured", op.Name),
+			}}})
+			return
+		}
+		writeJSON(w, http.StatusOK, graphqlResponse{Data: m.fakeOperation(op)})
+		return
+	}
+
+	if !injectDelay(r.Context(), time.Duration(stub.Delay)) {
+		return
+	}
+	status := cmp.Or(stub.Status, http.StatusOK)
+	if stub.ErrorRate > 0 && rand.Float64() < stub.ErrorRate {
+		writeJSON(w, status, graphqlResponse{Errors: []graphqlError{{Message: "injected error"}}})
+		return
+	}
+	resp := graphqlResponse{Data: stub.Data, Errors: stub.Errors}
+	if resp.Data == nil && m.schema != nil {
+		resp.Data = m.fakeOperation(op)
+	}
+	if len(resp.Errors) == 0 {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, resp)
+}
+
+func parseGraphQLRequest(r *http.Request) (graphqlRequest, error) {
+	var req graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return req, fmt.Errorf("invalid variables: %v", err)
+			}
+		}
+	case http.MethodPost:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxStubBody))
+		if err != nil {
+			return req, err
+		}
+		if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "application/graphql" {
+			req.Query = string(body)
+		} else if err := json.Unmarshal(body, &req); err != nil {
+			return req, fmt.Errorf("invalid request body: %v", err)
+		}
+	default:
+		return req, fmt.Errorf("method %s not allowed (want GET or POST)", r.Method)
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return req, errors.New("missing query")
+	}
+	return req, nil
+}
+
+// operation parses the query of req, validating it when there is a schema,
+// and returns the operation to run.
+func (m *graphqlMock) operation(req graphqlRequest) (*ast.OperationDefinition, error) {
+	var doc *ast.QueryDocument
+	if m.schema != nil {
+		var errs gqlerror.List
+		if doc, errs = gqlparser.LoadQuery(m.schema, req.Query); len(errs) > 0 {
+			return nil, errs
+		}
+	} else {
+		var err error
+		if doc, err = parser.ParseQuery(&ast.Source{Input: req.Query}); err != nil {
+			return nil, err
+		}
+	}
+	if req.OperationName == "" && len(doc.Operations) > 1 {
+		return nil, errors.New("operationName is required for documents with several operations")
+	}
+	if req.OperationName == "" {
+		return doc.Operations[0], nil
+	}
+	op := doc.Operations.ForName(req.OperationName)
+	if op == nil {
+		return nil, fmt.Errorf("unknown operation %q", req.OperationName)
+	}
+	return op, nil
+}
+
+// match returns the first stub for op, or nil.
+func (m *graphqlMock) match(op *ast.OperationDefinition) *graphqlOperation {
+	var field string
+	if len(op.SelectionSet) > 0 {
+		if f, ok := op.SelectionSet[0].(*ast.Field); ok {
+			field = f.Name
+		}
+	}
+	for i := range m.operations {
+		st := &m.operations[i]
+		if (st.Operation != "" && st.Operation == op.Name) || (st.Field != "" && st.Field == field) {
+			return st
+		}
+	}
+	return nil
+}
+
+// fakeOperation generates data for op that follows the schema.
+func (m *graphqlMock) fakeOperation(op *ast.OperationDefinition) any {
+	root := m.schema.Query
+	switch op.Operation {
+	case ast.Mutation:
+		root = m.schema.Mutation
+	case ast.Subscription:
+		root = m.schema.Subscription
+	}
+	if root == nil {
+		return nil
+	}
+	return m.fakeObject(root, op.SelectionSet)
+}
+
+// fakeObject fills in the selected fields of an object of type def. Abstract
+// types are answered with their first implementation.
+func (m *graphqlMock) fakeObject(def *ast.Definition, set ast.SelectionSet) map[string]any {
+	if def.IsAbstractType() {
+		if possible := m.schema.GetPossibleTypes(def); len(possible) > 0 {
+			def = possible[0]
+		}
+	}
+	out := make(map[string]any)
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			name := cmp.Or(sel.Alias, sel.Name)
+			if sel.Name == "__typename" {
+				out[name] = def.Name
+			} else if sel.Definition != nil {
+				out[name] = m.fakeValue(sel.Definition.Type, sel.SelectionSet)
+			}
+		case *ast.InlineFragment:
+			if m.applies(sel.TypeCondition, def) {
+				maps.Copy(out, m.fakeObject(def, sel.SelectionSet))
+			}
+		case *ast.FragmentSpread:
+			if sel.Definition != nil && m.applies(sel.Definition.TypeCondition, def) {
+				maps.Copy(out, m.fakeObject(def, sel.Definition.SelectionSet))
+			}
+		}
+	}
+	return out
+}
+
+// applies reports whether a fragment on type cond applies to objects of type
+// def.
+func (m *graphqlMock) applies(cond string, def *ast.Definition) bool {
+	if cond == "" || cond == def.Name {
+		return true
+	}
+	if t := m.schema.Types[cond]; t != nil {
+		return slices.Contains(m.schema.GetPossibleTypes(t), def)
+	}
+	return false
+}
+
+// fakeValue generates a value of type t. Lists get two elements.
+func (m *graphqlMock) fakeValue(t *ast.Type, set ast.SelectionSet) any {
+	if t.Elem != nil {
+		return []any{m.fakeValue(t.Elem, set), m.fakeValue(t.Elem, set)}
+	}
+	def := m.schema.Types[t.NamedType]
+	if def == nil {
+		return nil
+	}
+	switch def.Kind {
+	case ast.Object, ast.Interface, ast.Union:
+		return m.fakeObject(def, set)
+	case ast.Enum:
+		if len(def.EnumValues) == 0 {
+			return nil
+		}
+		return def.EnumValues[rand.IntN(len(def.EnumValues))].Name
+	}
+	switch def.Name {
+	case "Int":
+		return rand.IntN(1000)
+	case "Float":
+		return float64(rand.IntN(100000)) / 100
+	case "Boolean":
+		return rand.IntN(2) == 1
+	case "ID":
+		return newUUID()
+	default:
+		return templateFuncs["randString"].(func(int) string)(8)
+	}
+}
@@ -0,0 +1,187 @@
+package mockserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"server/metrics"
+)
+
+const mockServiceName = "mock.v1.Mock"
+
+// mockServiceDesc describes the mock.v1.Mock gRPC service. Both methods take
+// and return a google.protobuf.Struct, so clients need no generated code
+// beyond the well-known types:
+//
+//	rpc Echo(google.protobuf.Struct) returns (google.protobuf.Struct);
+//	rpc Get(google.protobuf.Struct) returns (google.protobuf.Struct);
+//
+// Echo returns its request. Get returns the mock response after the
+// configured delay, failing like the HTTP mock handler does with -error-rate;
+// the x-inject-delay and x-inject-status metadata override them per call.
+var mockServiceDesc = grpc.ServiceDesc{
+	ServiceName: mockServiceName,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Echo", Handler: unaryStructHandler("Echo", (*server).grpcEcho)},
+		{MethodName: "Get", Handler: unaryStructHandler("Get", (*server).grpcGet)},
+	},
+	Metadata: "mock/v1/mock.proto",
+}
+
+// unaryStructHandler adapts a method taking and returning a Struct to the
+// grpc.MethodDesc handler signature, running the interceptors.
+func unaryStructHandler(name string, method func(*server, context.Context, *structpb.Struct) (*structpb.Struct, error)) grpc.MethodHandler {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		in := new(structpb.Struct)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		call := func(ctx context.Context, req any) (any, error) {
+			return method(srv.(*server), ctx, req.(*structpb.Struct))
+		}
+		if interceptor == nil {
+			return call(ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + mockServiceName + "/" + name}
+		return interceptor(ctx, in, info, call)
+	}
+}
+
+func (s *server) grpcEcho(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	return in, nil
+}
+
+func (s *server) grpcGet(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	b := s.behavior.Load()
+	inj := s.inject(b)
+	delay, code := inj.delay, inj.status
+	delaySource, cause := "config", inj.cause
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("x-inject-delay"); len(v) > 0 {
+		d, err := time.ParseDuration(v[0])
+		if err != nil || d < 0 || d > maxOverrideDelay {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid delay %q (want a duration up to %v)", v[0], maxOverrideDelay)
+		}
+		delay, delaySource = d, "override"
+	}
+	if v := md.Get("x-inject-status"); len(v) > 0 {
+		c, err := strconv.Atoi(v[0])
+		if err != nil || c < 200 || c > 599 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid status %q (want 200-599)", v[0])
+		}
+		code, cause = c, "override"
+	}
+
+	metrics.InjectedDelay(delaySource, delay)
+	if !sleepCtx(ctx, delay) {
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	if code >= 400 {
+		metrics.InjectedError(cause, code)
+		return nil, status.Error(grpcCode(code), "injected error: "+http.StatusText(code))
+	}
+	out := make(map[string]any, len(mockResponse))
+	for k, v := range mockResponse {
+		out[k] = v
+	}
+	return structpb.NewStruct(out)
+}
+
+// grpcCode maps an HTTP status code to the closest gRPC status code, as
+// gRPC-to-HTTP gateways do in reverse.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if httpStatus < 500 {
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
+
+// grpcService runs the gRPC server on addr, with the mock service and the
+// standard health service.
+type grpcService struct {
+	*grpc.Server
+	addr string
+	lc   net.ListenConfig
+	ln   net.Listener
+}
+
+func (s *server) newGRPCService(addr string, lc net.ListenConfig) *grpcService {
+	gs := grpc.NewServer(grpc.UnaryInterceptor(metrics.UnaryServerInterceptor))
+	gs.RegisterService(&mockServiceDesc, s)
+	healthpb.RegisterHealthServer(gs, health.NewServer())
+	return &grpcService{Server: gs, addr: addr, lc: lc}
+}
+
+func (g *grpcService) Listen(ctx context.Context) (err error) {
+	g.ln, err = listen(ctx, g.lc, "tcp", g.addr)
+	return err
+}
+
+func (g *grpcService) localAddr() net.Addr {
+	if g.ln == nil {
+		return nil
+	}
+	return g.ln.Addr()
+}
+
+func (g *grpcService) Serve() error {
+	if err := g.Server.Serve(g.ln); err != nil {
+		return err
+	}
+	return http.ErrServerClosed
+}
+
+// Shutdown waits for pending calls to finish, cancelling them when ctx is
+// done.
+func (g *grpcService) Shutdown(ctx context.Context) error {
+	// The server only closes the listener if it served on it.
+	defer func() {
+		if g.ln != nil {
+			g.ln.Close()
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		g.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		g.Stop()
+		return ctx.Err()
+	}
+}
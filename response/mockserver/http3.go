@@ -0,0 +1,76 @@
+package mockserver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newHTTP3Service returns an HTTP/3 (QUIC) server for addr. QUIC always runs
+// over TLS, so tlsCfg is required.
+func (c *config) newHTTP3Service(addr string, handler http.Handler, tlsCfg *tls.Config) *http3Service {
+	return &http3Service{Server: &http3.Server{
+		Addr:           addr,
+		Handler:        handler,
+		TLSConfig:      http3.ConfigureTLSConfig(tlsCfg.Clone()),
+		MaxHeaderBytes: c.maxHeaderBytes,
+		IdleTimeout:    c.idleTimeout,
+	}}
+}
+
+// http3Service runs an HTTP/3 server on a UDP socket it opens itself.
+type http3Service struct {
+	*http3.Server
+	conn net.PacketConn
+	// portFrom, if set, is the TCP listener whose port is shared when Addr
+	// asks for any free port (port 0), so HTTP/3 is found where the
+	// Alt-Svc header of that listener says.
+	portFrom *httpService
+}
+
+func (s *http3Service) Listen(ctx context.Context) (err error) {
+	if host, port, err := net.SplitHostPort(s.Addr); err == nil && port == "0" && s.portFrom != nil {
+		if tcp, ok := s.portFrom.localAddr().(*net.TCPAddr); ok {
+			s.Addr = net.JoinHostPort(host, strconv.Itoa(tcp.Port))
+		}
+	}
+	var lc net.ListenConfig
+	s.conn, err = lc.ListenPacket(ctx, "udp", s.Addr)
+	return err
+}
+
+func (s *http3Service) localAddr() net.Addr {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.LocalAddr()
+}
+
+func (s *http3Service) Serve() error {
+	return s.Server.Serve(s.conn)
+}
+
+// Shutdown stops the server gracefully and then closes the socket, which
+// the server leaves open as it did not create it.
+func (s *http3Service) Shutdown(ctx context.Context) error {
+	err := s.Server.Shutdown(ctx)
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return err
+}
+
+// advertiseHTTP3 adds an Alt-Svc header pointing at h3 to every response, so
+// clients that connected over TCP learn they can switch to HTTP/3.
+func advertiseHTTP3(h3 *http3Service, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fails only until the QUIC listener is up; the header is then
+		// simply omitted.
+		h3.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,233 @@
+package mockserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+
+	"server/metrics"
+)
+
+// newHTTPMetrics creates the request metrics of the routes as set by the
+// -metrics-* flags, in the server's registry unless -metrics-backend sends
+// them elsewhere. It also returns a function flushing the metrics not yet
+// exported, or nil.
+func newHTTPMetrics(cfg *config) (*metrics.Metrics, func(), error) {
+	opts := []metrics.Option{metrics.WithPrefix(cfg.metricsPrefix)}
+	if len(cfg.metricsBuckets) > 0 {
+		opts = append(opts, metrics.WithBuckets(cfg.metricsBuckets...))
+	}
+	if cfg.metricsNativeFactor > 0 {
+		opts = append(opts, metrics.WithNativeHistogram(cfg.metricsNativeFactor))
+	}
+	if cfg.metricsDuration != "histogram" {
+		opts = append(opts, metrics.WithSummary(cfg.metricsObjectives))
+	}
+	if cfg.metricsDuration == "summary" {
+		opts = append(opts, metrics.WithoutHistogram())
+	}
+	if cfg.metricsRoutes > 0 {
+		opts = append(opts, metrics.WithRoutes(cfg.metricsRoutes))
+	}
+	if len(cfg.metricsSkipPaths) > 0 {
+		opts = append(opts, metrics.WithSkipPaths(cfg.metricsSkipPaths...))
+	}
+	if len(cfg.metricsSkipMethods) > 0 {
+		opts = append(opts, metrics.WithSkipMethods(cfg.metricsSkipMethods...))
+	}
+	if len(cfg.metricsHeaderLabels) > 0 {
+		opts = append(opts, metrics.WithHeaderLabels(cfg.metricsHeaderValues, cfg.metricsHeaderLabels...))
+	}
+	if len(cfg.metricsLabels) > 0 {
+		opts = append(opts, metrics.WithConstLabels(cfg.metricsLabels))
+	}
+
+	var flush func()
+	switch cfg.metricsBackend {
+	case "otel":
+		mp, err := setupMetricsExport(metricsEndpoint(cfg.otlpEndpoint), cfg.metricsLabels)
+		if err != nil {
+			return nil, nil, err
+		}
+		rec, err := metrics.NewOTelRecorder(mp)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, metrics.WithRecorder(rec))
+		flush = func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := mp.Shutdown(ctx); err != nil {
+				log.Printf("ERROR flushing metrics: %v", err)
+			}
+		}
+	case "statsd":
+		rec, err := metrics.NewStatsdRecorder(cfg.statsdAddr, cfg.metricsPrefix, cfg.metricsLabels)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, metrics.WithRecorder(rec))
+	}
+	m, err := metrics.NewMetrics(cfg.registerer(), opts...)
+	return m, flush, err
+}
+
+// setupMetricsExport creates a meter provider exporting every 15 seconds
+// over OTLP/HTTP to endpoint, with the -metrics-labels as resource
+// attributes.
+func setupMetricsExport(endpoint string, labels map[string]string) (*sdkmetric.MeterProvider, error) {
+	ctx := context.Background()
+	exporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	attrs := []attribute.KeyValue{semconv.ServiceName("mock-server")}
+	for name, value := range labels {
+		attrs = append(attrs, attribute.String(name, value))
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attrs...),
+		resource.WithFromEnv(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(15*time.Second))),
+		sdkmetric.WithResource(res),
+	), nil
+}
+
+// metricsEndpoint returns the OTLP/HTTP URL for metrics of the collector
+// receiving the traces at tracesURL.
+func metricsEndpoint(tracesURL string) string {
+	if base, ok := strings.CutSuffix(tracesURL, "/v1/traces"); ok {
+		return base + "/v1/metrics"
+	}
+	return tracesURL
+}
+
+// registerer returns the registry of the server's metrics: the one given
+// with WithRegistry, or the default one.
+func (cfg *config) registerer() prometheus.Registerer {
+	if cfg.registry != nil {
+		return cfg.registry
+	}
+	return prometheus.DefaultRegisterer
+}
+
+// gatherer returns what /metrics serves: the registry of the server's
+// metrics.
+func (cfg *config) gatherer() prometheus.Gatherer {
+	if cfg.registry != nil {
+		return cfg.registry
+	}
+	return prometheus.DefaultGatherer
+}
+
+// parseBuckets parses a comma-separated list of increasing durations into
+// histogram bucket bounds in seconds.
+func parseBuckets(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var buckets []float64
+	for _, f := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 || (len(buckets) > 0 && d.Seconds() <= buckets[len(buckets)-1]) {
+			return nil, fmt.Errorf("bounds must be positive and increasing, got %s", f)
+		}
+		buckets = append(buckets, d.Seconds())
+	}
+	return buckets, nil
+}
+
+// parseQuantiles parses a comma-separated list of quantiles into summary
+// objectives, allowing each an error of a tenth of its distance to 1, e.g.
+// 0.01 for 0.9 and 0.001 for 0.99.
+func parseQuantiles(s string) (map[float64]float64, error) {
+	objectives := make(map[float64]float64)
+	for _, f := range splitList(s) {
+		q, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, err
+		}
+		if q <= 0 || q >= 1 {
+			return nil, fmt.Errorf("quantiles must be between 0 and 1, got %s", f)
+		}
+		objectives[q] = (1 - q) / 10
+	}
+	if len(objectives) == 0 {
+		return nil, errors.New("no quantiles")
+	}
+	return objectives, nil
+}
+
+// parseLabels parses comma-separated name=value pairs.
+func parseLabels(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, f := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(f), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("want name=value, got %q", f)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// labelName matches the label names Prometheus accepts everywhere.
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// parseHeaderLabels parses comma-separated name=Header pairs, or bare
+// headers named after the header in lower case with _ for -.
+func parseHeaderLabels(s string) ([]metrics.HeaderLabel, error) {
+	var labels []metrics.HeaderLabel
+	for _, f := range splitList(s) {
+		name, header, ok := strings.Cut(f, "=")
+		if !ok {
+			header = name
+			name = strings.ToLower(strings.ReplaceAll(header, "-", "_"))
+		}
+		if header == "" || !labelName.MatchString(name) {
+			return nil, fmt.Errorf("want name=Header or Header with a valid label name, got %q", f)
+		}
+		switch name {
+		case "handler", "method", "code", "proto", "listener", "tenant", "route":
+			return nil, fmt.Errorf("%s is already a label of the request metrics", name)
+		}
+		labels = append(labels, metrics.HeaderLabel{Name: name, Header: header})
+	}
+	return labels, nil
+}
+
+// splitList splits a comma-separated list, dropping empty elements.
+func splitList(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+package mockserver
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// inspectedRequest is one request as shown by /__inspect.
+type inspectedRequest struct {
+	Time     time.Time   `json:"time"`
+	Method   string      `json:"method"`
+	URI      string      `json:"uri"`
+	Proto    string      `json:"proto"`
+	Status   int         `json:"status"`
+	ClientIP string      `json:"client_ip"`
+	Headers  http.Header `json:"headers"`
+	// Body holds at most -inspect-max-body bytes of the request body,
+	// base64 encoded when it is not valid UTF-8.
+	Body          string `json:"body"`
+	BodyEncoding  string `json:"body_encoding,omitempty"`
+	BodyTruncated bool   `json:"body_truncated,omitempty"`
+}
+
+// inspector keeps the last requests in a ring buffer for /__inspect, so tests
+// using the server as a stub can see exactly what was sent to it.
+type inspector struct {
+	maxBody int64
+
+	mu      sync.Mutex
+	entries []*inspectedRequest // oldest at next once full
+	next    int
+	full    bool
+}
+
+func newInspector(size int, maxBody int64) *inspector {
+	return &inspector{maxBody: maxBody, entries: make([]*inspectedRequest, size)}
+}
+
+func (in *inspector) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		e := &inspectedRequest{
+			Time:     time.Now(),
+			Method:   r.Method,
+			URI:      r.RequestURI,
+			Proto:    r.Proto,
+			ClientIP: clientIP(r),
+			Headers:  r.Header.Clone(),
+		}
+		body := &capturedBody{ReadCloser: r.Body, max: in.maxBody}
+		r.Body = body
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// Show the start of the body even if the handler never read it.
+		if remaining := in.maxBody - int64(len(body.buf)); remaining > 0 {
+			io.CopyN(io.Discard, body, remaining+1)
+		}
+		e.Status = rec.status
+		e.BodyTruncated = body.read > in.maxBody
+		if utf8.Valid(body.buf) {
+			e.Body = string(body.buf)
+		} else {
+			e.Body = base64.StdEncoding.EncodeToString(body.buf)
+			e.BodyEncoding = "base64"
+		}
+		in.add(e)
+	})
+}
+
+func (in *inspector) add(e *inspectedRequest) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.entries[in.next] = e
+	in.next = (in.next + 1) % len(in.entries)
+	if in.next == 0 {
+		in.full = true
+	}
+}
+
+// list returns the buffered requests, newest first.
+func (in *inspector) list() []*inspectedRequest {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	n := in.next
+	if in.full {
+		n = len(in.entries)
+	}
+	out := make([]*inspectedRequest, 0, n)
+	for i := range n {
+		out = append(out, in.entries[(in.next-1-i+len(in.entries))%len(in.entries)])
+	}
+	return out
+}
+
+func (in *inspector) clear() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	clear(in.entries)
+	in.next, in.full = 0, false
+}
+
+// capturedBody keeps the first max bytes read from a request body.
+type capturedBody struct {
+	io.ReadCloser
+	max  int64
+	buf  []byte
+	read int64
+}
+
+func (c *capturedBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if keep := min(int64(n), c.max-int64(len(c.buf))); keep > 0 {
+		c.buf = append(c.buf, p[:keep]...)
+	}
+	c.read += int64(n)
+	return n, err
+}
+
+// inspectHandler lists the last -inspect-size requests, newest first; DELETE
+// empties the buffer.
+func (s *server) inspectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		s.inspector.clear()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.inspector.list())
+}
@@ -0,0 +1,78 @@
+package mockserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"server/metrics"
+)
+
+// ipFilter answers 403 Forbidden to clients whose IP is in a deny list or,
+// when there is an allow list, not in it. Deny rules win over allow rules.
+// It looks at the peer address only, never at forwarding headers that the
+// client could forge. Clients on unix sockets have no IP and are let through.
+type ipFilter struct {
+	allow, deny []netip.Prefix
+}
+
+// parseCIDRs parses a comma-separated list of CIDR blocks and single IP
+// addresses.
+func parseCIDRs(s string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+// decide reports whether ip may connect and the rule that decided it, or
+// "default" when no rule matched.
+func (f *ipFilter) decide(ip netip.Addr) (bool, string) {
+	ip = ip.Unmap()
+	for _, p := range f.deny {
+		if p.Contains(ip) {
+			return false, p.String()
+		}
+	}
+	for _, p := range f.allow {
+		if p.Contains(ip) {
+			return true, p.String()
+		}
+	}
+	return len(f.allow) == 0, "default"
+}
+
+func (f *ipFilter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, err := netip.ParseAddr(clientIP(r))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed, rule := f.decide(ip)
+		metrics.IPFilterDecision(allowed, rule)
+		if !allowed {
+			http.Error(w, fmt.Sprintf("client %s is not allowed", ip), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
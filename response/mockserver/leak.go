@@ -0,0 +1,111 @@
+package mockserver
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"server/metrics"
+)
+
+// Leak modes.
+const (
+	leakGoroutine  = "goroutine"  // start a goroutine that never returns
+	leakConnection = "connection" // answer over a hijacked connection that is never closed
+)
+
+// leakInjector makes a fraction of requests leak a goroutine or a
+// connection, so monitoring and the client's degradation detection can be
+// checked against a server known to be going bad. Leaks pile up until they
+// are released through the admin API.
+type leakInjector struct {
+	rate float64
+	mode string
+}
+
+func (l leakInjector) validate() error {
+	if l.rate < 0 || l.rate > 1 {
+		return fmt.Errorf("leak rate must be between 0 and 1, got %v", l.rate)
+	}
+	if l.mode != leakGoroutine && l.mode != leakConnection {
+		return fmt.Errorf("unknown leak mode %q (want %s or %s)", l.mode, leakGoroutine, leakConnection)
+	}
+	return nil
+}
+
+// leaks holds what has been leaked so that it can be released.
+var leaks = struct {
+	sync.Mutex
+	release chan struct{} // closed to end the leaked goroutines
+	conns   []net.Conn
+}{release: make(chan struct{})}
+
+// leak wraps next so that the requests picked by the current behaviour leak.
+// A connection that cannot be hijacked (HTTP/2 and HTTP/3) leaks a goroutine
+// instead.
+func (s *server) leak(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := s.behavior.Load().leak
+		if controlPath(r.URL.Path) || l.rate <= 0 || rand.Float64() >= l.rate {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if l.mode == leakConnection && leakConn(w) {
+			return
+		}
+		startLeakedGoroutine()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startLeakedGoroutine starts a goroutine holding some memory until the
+// leaks are released.
+func startLeakedGoroutine() {
+	leaks.Lock()
+	release := leaks.release
+	leaks.Unlock()
+	metrics.Leaked(leakGoroutine)
+	go func() {
+		buf := make([]byte, 64<<10)
+		<-release
+		runtime.KeepAlive(buf)
+	}()
+}
+
+// leakConn sends the mock response over the hijacked connection and then
+// keeps it open without ever reading from it again, so a client reusing the
+// connection hangs. It reports false if the connection cannot be hijacked.
+func leakConn(w http.ResponseWriter) bool {
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return false
+	}
+	fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n", len(mockResponseBytes))
+	buf.Write(mockResponseBytes)
+	if err := buf.Flush(); err != nil {
+		log.Printf("Leak: writing response: %v", err)
+	}
+	leaks.Lock()
+	leaks.conns = append(leaks.conns, conn)
+	leaks.Unlock()
+	metrics.Leaked(leakConnection)
+	return true
+}
+
+// releaseLeaks ends every leaked goroutine and closes every leaked
+// connection.
+func releaseLeaks() {
+	leaks.Lock()
+	defer leaks.Unlock()
+	close(leaks.release)
+	leaks.release = make(chan struct{})
+	for _, c := range leaks.conns {
+		c.Close()
+	}
+	leaks.conns = nil
+	metrics.LeaksReleased()
+}
@@ -0,0 +1,120 @@
+package mockserver
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listenerSpec is an extra listener from -listen, serving the mock with its
+// own behaviour.
+type listenerSpec struct {
+	name     string
+	addr     string
+	tls      bool
+	behavior behavior
+}
+
+// parseListenerSpec parses a -listen value: an address optionally followed
+// by query-style options, e.g.
+//
+//	:8081?name=slow&delay=100ms&error-rate=0.1&error-codes=500,503
+//	:8443?tls
+//
+// The options are name (the listener label in the metrics, by default the
+// address), tls, and the behaviour settings delay, delay-distribution,
+// delay-stddev, delay-max, error-rate, error-codes and response-size. Unset
+// behaviour settings are inherited from base.
+func parseListenerSpec(s string, base behavior) (listenerSpec, error) {
+	addr, rawOpts, _ := strings.Cut(s, "?")
+	opts, err := url.ParseQuery(rawOpts)
+	if err != nil {
+		return listenerSpec{}, err
+	}
+	l := listenerSpec{name: addr, addr: addr, behavior: base}
+	for key, values := range opts {
+		v := values[len(values)-1]
+		switch key {
+		case "name":
+			l.name = v
+		case "tls":
+			l.tls = v == "" || v == "true"
+		default:
+			var known bool
+			if known, err = setBehaviorOption(&l.behavior, key, v); !known {
+				return listenerSpec{}, fmt.Errorf("unknown option %q", key)
+			}
+		}
+		if err != nil {
+			return listenerSpec{}, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if addr == "" {
+		return listenerSpec{}, fmt.Errorf("missing address in %q", s)
+	}
+	if err := l.behavior.validate(); err != nil {
+		return listenerSpec{}, err
+	}
+	return l, nil
+}
+
+// setBehaviorOption applies one of the behaviour options shared by -listen
+// and -tenant to b, and reports false if key is not one of them.
+func setBehaviorOption(b *behavior, key, v string) (known bool, err error) {
+	switch key {
+	case "delay":
+		b.delay.base, err = time.ParseDuration(v)
+	case "delay-distribution":
+		b.delay.dist = v
+	case "delay-stddev":
+		b.delay.stddev, err = time.ParseDuration(v)
+	case "delay-max":
+		b.delay.max, err = time.ParseDuration(v)
+	case "error-rate":
+		b.errors.rate, err = strconv.ParseFloat(v, 64)
+	case "error-codes":
+		b.errors.codes, err = parseStatusCodes(v)
+	case "response-size":
+		b.responseSize, err = parseSizeRange(v)
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+// withBehavior returns a server sharing everything with s except the
+// behaviour, which starts as b. The admin API only changes the main server.
+func (s *server) withBehavior(b behavior) *server {
+	ls := &server{
+		cfg:         s.cfg,
+		payload:     s.payload,
+		poll:        s.poll,
+		auth:        s.auth,
+		cache:       s.cache,
+		requests:    s.requests,
+		inspector:   s.inspector,
+		clients:     s.clients,
+		series:      s.series,
+		degrade:     s.degrade,
+		ramp:        s.ramp,
+		proxy:       s.proxy,
+		mirror:      s.mirror,
+		graphql:     s.graphql,
+		stubs:       s.stubs,
+		openapi:     s.openapi,
+		compressor:  s.compressor,
+		accessLog:   s.accessLog,
+		httpMetrics: s.httpMetrics,
+		// Shared so that the limits hold for the whole server.
+		rateLimiter:   s.rateLimiter,
+		concurrency:   s.concurrency,
+		responseCache: s.responseCache,
+		// Shared so that reloads reach every listener.
+		configRoutes: s.configRoutes,
+		done:         s.done,
+	}
+	ls.behavior.Store(&b)
+	return ls
+}
@@ -0,0 +1,84 @@
+package mockserver
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// burnResponse is the body sent by /burn.
+type burnResponse struct {
+	CPU    duration `json:"cpu"`
+	Hashes int      `json:"hashes"`
+}
+
+// burnHandler keeps a CPU core busy for ?cpu= (at most -max-burn) before
+// answering, to emulate compute-heavy backends.
+func (s *server) burnHandler(w http.ResponseWriter, r *http.Request) {
+	d, err := time.ParseDuration(r.URL.Query().Get("cpu"))
+	if err != nil || d < 0 || d > s.cfg.maxBurn {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "cpu must be a duration up to " + s.cfg.maxBurn.String()})
+		return
+	}
+	ctx := r.Context()
+	sum := sha256.Sum256(nil)
+	hashes := 0
+	for start := time.Now(); time.Since(start) < d; hashes++ {
+		sum = sha256.Sum256(sum[:])
+		if hashes%1024 == 0 && ctx.Err() != nil {
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, burnResponse{CPU: duration(d), Hashes: hashes})
+}
+
+// allocResponse is the body sent by /alloc.
+type allocResponse struct {
+	Bytes int64    `json:"bytes"`
+	Held  duration `json:"held"`
+}
+
+// allocated is the memory currently held by /alloc requests.
+var allocated atomic.Int64
+
+// allocHandler allocates ?mb= megabytes, touching every page so the memory
+// is really used, and keeps it for ?hold= before answering. The memory is
+// garbage once the request is done, which puts pressure on the GC. Requests
+// that would take the memory held by /alloc over -max-alloc get 503.
+func (s *server) allocHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	mb, err := strconv.ParseInt(q.Get("mb"), 10, 64)
+	if err != nil || mb < 0 || mb > s.cfg.maxAlloc>>20 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mb must be a whole number of megabytes up to " + strconv.FormatInt(s.cfg.maxAlloc>>20, 10)})
+		return
+	}
+	var hold time.Duration
+	if v := q.Get("hold"); v != "" {
+		if hold, err = time.ParseDuration(v); err != nil || hold < 0 || hold > maxOverrideDelay {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "hold must be a duration up to " + maxOverrideDelay.String()})
+			return
+		}
+	}
+	n := mb << 20
+	if allocated.Add(n) > s.cfg.maxAlloc {
+		allocated.Add(-n)
+		w.Header().Set("Retry-After", "1")
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "-max-alloc reached"})
+		return
+	}
+	defer allocated.Add(-n)
+
+	buf := make([]byte, n)
+	for i := 0; i < len(buf); i += 4096 {
+		buf[i] = 1
+	}
+	ok := sleepCtx(r.Context(), hold)
+	runtime.KeepAlive(buf)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, allocResponse{Bytes: n, Held: duration(hold)})
+}
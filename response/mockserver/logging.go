@@ -0,0 +1,20 @@
+package mockserver
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// newLogger returns a logger writing to stderr in the given format: "logfmt"
+// (key=value pairs) or "json".
+func newLogger(format string) (*slog.Logger, error) {
+	switch format {
+	case "logfmt", "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, nil)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, nil)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want logfmt or json)", format)
+	}
+}
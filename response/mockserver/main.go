@@ -0,0 +1,84 @@
+package mockserver
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"server/metrics"
+)
+
+// Main runs the server binary: it configures the server from the command
+// line, serves until SIGINT or SIGTERM and then shuts down gracefully.
+func Main() {
+	cfg, err := parseConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Fatal Error: %v", err)
+	}
+	if cfg.showVersion {
+		fmt.Println("mock-server", metrics.BuildVersion())
+		return
+	}
+	logger, err := newLogger(cfg.logFormat)
+	if err != nil {
+		log.Fatalf("Fatal Error: invalid -log-format: %v", err)
+	}
+	// Plain log.Printf lines go through the same handler as access logs.
+	slog.SetDefault(logger)
+	c, err := configFrom(cfg)
+	if err != nil {
+		log.Fatalf("Fatal Error: %v", err)
+	}
+	srv, err := newFromConfig(c, os.Stdout)
+	if err != nil {
+		log.Fatalf("Fatal Error: %v", err)
+	}
+	if cfg.configFile != "" {
+		go srv.srv.watchConfig()
+	}
+
+	// SIGINT (Ctrl+C) and SIGTERM (Kubernetes, docker stop) start a
+	// graceful shutdown.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// The restart signal hands the listeners to a new server process and
+	// then shuts this one down the same way.
+	if restartSignal != nil {
+		restarts := make(chan os.Signal, 1)
+		signal.Notify(restarts, restartSignal)
+		go func() {
+			for range restarts {
+				p, err := restart()
+				if err != nil {
+					log.Printf("ERROR restarting: %v", err)
+					continue
+				}
+				log.Printf("Restarted as process %d", p.Pid)
+				stop()
+				return
+			}
+		}()
+	}
+
+	// A server that fails to start (e.g. the port is already in use) or
+	// stops serving crashes the app.
+	if err := srv.Start(ctx); err != nil {
+		log.Fatalf("Fatal Error: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case err := <-srv.failed:
+		log.Fatalf("Fatal Error: %v", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("ERROR during shutdown: %v", err)
+	}
+}
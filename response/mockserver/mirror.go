@@ -0,0 +1,106 @@
+package mockserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"server/metrics"
+)
+
+// maxMirrorsInFlight bounds the mirrored requests waiting on the shadow
+// upstream; beyond it requests are not mirrored, so a slow shadow cannot pile
+// up goroutines.
+const maxMirrorsInFlight = 1000
+
+// maxMirrorBody is the largest request body that is mirrored; larger ones
+// are streamed to the primary upstream only, instead of being held in memory.
+const maxMirrorBody = 1 << 20
+
+// mirror copies a fraction rate of the proxied requests to a shadow upstream
+// in the background. Its responses are thrown away; only their status codes
+// and latencies are recorded, under the "shadow" upstream.
+type mirror struct {
+	target *url.URL
+	rate   float64
+	client *http.Client
+	slots  chan struct{}
+}
+
+func newMirror(target *url.URL, rate float64, timeout time.Duration) *mirror {
+	return &mirror{
+		target: target,
+		rate:   rate,
+		client: &http.Client{
+			Transport: &upstreamTransport{name: "shadow", next: http.DefaultTransport},
+			Timeout:   timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		slots: make(chan struct{}, maxMirrorsInFlight),
+	}
+}
+
+// send mirrors r if it is picked and its body is at most maxMirrorBody. The
+// body is read up front so both upstreams get a copy; r.Body is replaced with
+// one.
+func (m *mirror) send(r *http.Request) {
+	if rand.Float64() >= m.rate {
+		return
+	}
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		metrics.MirrorDropped()
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMirrorBody+1))
+	if err != nil {
+		<-m.slots
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+		return
+	}
+	if len(body) > maxMirrorBody {
+		<-m.slots
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	u := *m.target
+	u.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+	u.RawQuery = r.URL.RawQuery
+	// The shadow request must outlive the original one.
+	req, err := http.NewRequestWithContext(context.Background(), r.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		<-m.slots
+		log.Printf("Mirror: building request: %v", err)
+		return
+	}
+	req.Header = r.Header.Clone()
+	stripInjectHeaders(req.Header)
+	go func() {
+		defer func() { <-m.slots }()
+		resp, err := m.client.Do(req)
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// errReader returns err once the rest of a partly read body is used up.
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
@@ -0,0 +1,406 @@
+// Package mockserver is the mock HTTP server, importable so that integration
+// tests in other Go projects can run it in-process on an ephemeral port
+// instead of exec'ing the binary:
+//
+//	srv, err := mockserver.New(mockserver.WithArgs("-delay", "20ms", "-error-rate", "0.1"))
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	if err := srv.Start(ctx); err != nil {
+//		t.Fatal(err)
+//	}
+//	defer srv.Shutdown(context.Background())
+//	resp, err := http.Get(srv.URL() + "/fast")
+//
+// Every command-line flag of the binary is available through WithArgs. The
+// access log (see -log-sample) and, unless WithRegistry gives a server a
+// registry of its own, the metrics are shared by every server in the process.
+package mockserver
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"server/metrics"
+)
+
+// defaultAddr is where a Server listens unless told otherwise: a free port on
+// the loopback interface.
+const defaultAddr = "127.0.0.1:0"
+
+// Server is a mock server with all its listeners. Create it with New, then
+// call Start to serve and Shutdown to stop.
+type Server struct {
+	cfg *config
+	srv *server
+	out io.Writer
+	// endpoints are the listeners announced once they are open, in the
+	// order of the startup banner.
+	endpoints []endpoint
+
+	tracker *inflight
+	primary *httpService
+	// scheme is the scheme of the main listener.
+	scheme   string
+	services []service
+	// flushTraces is nil without -otlp-endpoint.
+	flushTraces func()
+	// failed receives the first error of a service that stopped serving
+	// on its own.
+	failed chan error
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// An Option configures a Server.
+type Option func(*options)
+
+type options struct {
+	args     []string
+	out      io.Writer
+	registry *prometheus.Registry
+}
+
+// WithArgs sets the server up with command-line flags, exactly as for the
+// binary (e.g. "-delay", "50ms" or "-tls-self-signed"). It can be given
+// several times.
+func WithArgs(args ...string) Option {
+	return func(o *options) { o.args = append(o.args, args...) }
+}
+
+// WithAddr sets the address of the main listener. Without it, and without
+// -addr, -host or -port in the arguments, the server listens on a free port
+// of 127.0.0.1.
+func WithAddr(addr string) Option {
+	return WithArgs("-addr", addr)
+}
+
+// WithOutput sets where the startup lines go; they are discarded by default.
+func WithOutput(w io.Writer) Option {
+	return func(o *options) { o.out = w }
+}
+
+// WithRegistry registers the server's metrics with reg, and serves reg on
+// /metrics, rather than the default registry, so that the request metrics of
+// servers in the same process are kept apart. The metrics of the server's
+// features, such as connections and limits, still count for the whole
+// process.
+func WithRegistry(reg *prometheus.Registry) Option {
+	return func(o *options) { o.registry = reg }
+}
+
+// Config is a parsed and checked server configuration, with the state its
+// handlers share: recorded requests, client stats, loaded stubs and so on.
+type Config struct {
+	cfg *config
+	srv *server
+}
+
+// NewConfig returns the configuration set by opts. Configuration errors, such
+// as an invalid flag or a stub file that does not parse, are returned rather
+// than fatal.
+func NewConfig(opts ...Option) (*Config, error) {
+	return newOptions(opts).config()
+}
+
+func newOptions(opts []Option) options {
+	o := options{out: io.Discard}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o options) config() (*Config, error) {
+	fs := flag.NewFlagSet("mockserver", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg, err := parseConfig(fs, o.args)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.showVersion {
+		return nil, errors.New("-version only applies to the command line")
+	}
+	addrSet := false
+	fs.Visit(func(f *flag.Flag) {
+		addrSet = addrSet || f.Name == "addr" || f.Name == "host" || f.Name == "port"
+	})
+	if !addrSet {
+		cfg.addr = defaultAddr
+	}
+	cfg.registry = o.registry
+	return configFrom(cfg)
+}
+
+// configFrom loads the files cfg refers to and sets up the shared state.
+func configFrom(cfg *config) (*Config, error) {
+	srv, err := newServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.SetAccessLog(slog.Default(), cfg.logSample)
+	metrics.SetAccessLogKeep(cfg.logKeepErrors, cfg.logKeepSlow)
+	return &Config{cfg: cfg, srv: srv}, nil
+}
+
+// Handler returns what the main listener of a server configured by c
+// serves: the mock routes, the stubs, the admin API (unless -admin-addr is
+// set) and the whole middleware chain. It is meant for httptest.NewServer
+// or for mounting the mock in another server; listener settings such as
+// -port, -tls-* or -listen do not apply, and the -mocks file is not watched
+// for changes.
+func Handler(c *Config) http.Handler {
+	return c.srv.mainHandler()
+}
+
+// mainHandler returns the handler of the main listeners.
+func (s *server) mainHandler() http.Handler {
+	// Register the mock handler for all routes, plus the built-in scenarios
+	mux := http.NewServeMux()
+	s.routes(mux)
+	// The admin API lives on the main listener unless given its own.
+	// Profiling is always available on a separate admin listener, and on
+	// the main one only when asked for.
+	if s.cfg.adminAddr == "" {
+		s.adminRoutes(mux)
+		if s.cfg.enablePprof {
+			debugRoutes(mux)
+		}
+	}
+	handler := s.handler(mux)
+	if len(s.cfg.tenants) > 0 {
+		handler = s.tenantRouter(handler)
+	}
+	return handler
+}
+
+// New returns a server configured by opts. Configuration errors are returned
+// as by NewConfig.
+func New(opts ...Option) (*Server, error) {
+	o := newOptions(opts)
+	c, err := o.config()
+	if err != nil {
+		return nil, err
+	}
+	return newFromConfig(c, o.out)
+}
+
+// newFromConfig sets up the listeners for c.
+func newFromConfig(c *Config, out io.Writer) (*Server, error) {
+	cfg, srv := c.cfg, c.srv
+	s := &Server{cfg: cfg, srv: srv, out: out, tracker: &inflight{}, failed: make(chan error, 1)}
+	if cfg.adminAddr != "" {
+		adminMux := http.NewServeMux()
+		srv.adminRoutes(adminMux)
+		debugRoutes(adminMux)
+		var admin http.Handler = adminMux
+		if cfg.ipFilter != nil {
+			admin = cfg.ipFilter.wrap(admin)
+		}
+		svc := cfg.httpService(cfg.adminAddr, s.tracker.wrap(admin))
+		s.services = append(s.services, svc)
+		s.announce("admin", "http", svc, "Starting admin API on http://%s/admin/\n")
+	}
+	handler := s.tracker.wrap(srv.mainHandler())
+
+	s.primary = cfg.httpService(cfg.listenAddr(), handler)
+	if cfg.unixOnly {
+		s.primary = cfg.unixService(cfg.unixSocket, handler)
+	} else if cfg.unixSocket != "" {
+		// An extra unix socket is always plaintext, even with TLS on the
+		// TCP listeners; with -unix-only it is the primary and gets TLS.
+		svc := cfg.unixService(cfg.unixSocket, handler)
+		s.services = append(s.services, svc)
+		s.announce("unix", "http", svc, "Starting high-performance mock server on unix:%s\n")
+	}
+	s.services = append(s.services, s.primary)
+	if cfg.tlsEnabled() {
+		tlsCfg, err := cfg.tlsConfig()
+		if err != nil {
+			return nil, fmt.Errorf("TLS setup: %w", err)
+		}
+		secure := s.primary
+		if cfg.tlsAddr != "" {
+			secure = cfg.httpService(cfg.tlsAddr, handler)
+			s.services = append(s.services, secure)
+		}
+		secure.TLSConfig = tlsCfg
+
+		// HTTP/3 shares the TLS port number (over UDP) unless told
+		// otherwise, and is advertised on the TCP TLS listener.
+		if cfg.http3 {
+			h3 := cfg.newHTTP3Service(cmp.Or(cfg.http3Addr, secure.Addr), handler, tlsCfg)
+			if cfg.http3Addr == "" {
+				h3.portFrom = secure
+			}
+			secure.Handler = advertiseHTTP3(h3, handler)
+			s.services = append(s.services, h3)
+			s.announce("http3", "https", h3, "Starting high-performance mock server on https://%s (HTTP/3 over UDP)\n")
+		}
+		if secure != s.primary {
+			s.announce("tls", "https", secure, "Starting high-performance mock server on https://%s\n")
+		}
+	} else if cfg.http3 {
+		return nil, errors.New("-http3 needs TLS (-tls-cert/-tls-key or -tls-self-signed)")
+	}
+	for _, l := range cfg.listeners {
+		ls := srv.withBehavior(l.behavior)
+		lmux := http.NewServeMux()
+		ls.routes(lmux)
+		svc := cfg.httpService(l.addr, s.tracker.wrap(metrics.WithListener(l.name, ls.handler(lmux))))
+		scheme := "http"
+		if l.tls {
+			var err error
+			if svc.TLSConfig, err = cfg.listenerTLSConfig(); err != nil {
+				return nil, fmt.Errorf("TLS setup for -listen %s: %w", l.addr, err)
+			}
+			scheme = "https"
+		}
+		s.services = append(s.services, svc)
+		s.announce(l.name, scheme, svc, "Starting "+l.name+" listener on "+scheme+"://%s\n")
+	}
+	if cfg.grpcAddr != "" {
+		svc := srv.newGRPCService(cfg.grpcAddr, cfg.listenConfig())
+		s.services = append(s.services, svc)
+		s.announce("grpc", "", svc, "Starting mock gRPC service on %s\n")
+	}
+	if cfg.tcpEchoAddr != "" {
+		svc := newTCPEchoService(cfg.tcpEchoAddr, cfg.listenConfig())
+		s.services = append(s.services, svc)
+		s.announce("tcp-echo", "", svc, "Starting TCP echo listener on %s\n")
+	}
+	if cfg.udpEchoAddr != "" {
+		svc := &udpEchoService{addr: cfg.udpEchoAddr, lc: cfg.listenConfig()}
+		s.services = append(s.services, svc)
+		s.announce("udp-echo", "", svc, "Starting UDP echo listener on %s\n")
+	}
+	s.scheme = "http"
+	if s.primary.TLSConfig != nil {
+		s.scheme = "https"
+	}
+	banner := "Starting high-performance mock server on " + s.scheme + "://%s\n"
+	if cfg.unixOnly {
+		banner = "Starting high-performance mock server on " + s.scheme + "://unix:%s\n"
+	}
+	s.announce("main", s.scheme, s.primary, banner)
+	return s, nil
+}
+
+// Start opens every listener and starts serving in the background. It
+// returns once the server accepts connections, or the first error opening a
+// listener (e.g. the port is already in use), after closing the others. ctx
+// only bounds opening the listeners; use Shutdown to stop the server.
+func (s *Server) Start(ctx context.Context) error {
+	if s.cfg.otlpEndpoint != "" {
+		flush, err := setupTracing(s.cfg.otlpEndpoint, s.cfg.traceSampleRate)
+		if err != nil {
+			return fmt.Errorf("tracing setup: %w", err)
+		}
+		s.flushTraces = flush
+	}
+	for i, svc := range s.services {
+		if err := svc.Listen(ctx); err != nil {
+			for _, opened := range s.services[:i] {
+				opened.Shutdown(context.Background())
+			}
+			return err
+		}
+	}
+	if err := s.announceReady(); err != nil {
+		for _, svc := range s.services {
+			svc.Shutdown(context.Background())
+		}
+		return err
+	}
+	if s.srv.stubs != nil {
+		go s.srv.stubs.watch(s.cfg.mocksPoll, s.srv.done)
+	}
+
+	// Each server handles every request in its own goroutine, so it's
+	// highly concurrent by default.
+	for _, svc := range s.services {
+		go func() {
+			if err := svc.Serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				select {
+				case s.failed <- err:
+				default:
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// Addr returns the address the main listener is bound to, with the actual
+// port when it was picked by the system. It is empty before Start.
+func (s *Server) Addr() string {
+	if s.primary.ln == nil {
+		return ""
+	}
+	return s.primary.ln.Addr().String()
+}
+
+// URL returns the base URL of the main listener, e.g.
+// "http://127.0.0.1:41234", with localhost for a wildcard address. It is
+// empty before Start and for a unix socket.
+func (s *Server) URL() string {
+	if s.primary.ln == nil || s.primary.network != "tcp" {
+		return ""
+	}
+	return s.scheme + "://" + dialAddr(s.primary.ln.Addr())
+}
+
+// Shutdown stops the server gracefully: listeners close immediately and
+// in-flight requests may finish until ctx is done. Calling it again returns
+// the result of the first call.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		close(s.srv.done)
+		pending := s.tracker.n.Load()
+		if deadline, ok := ctx.Deadline(); ok {
+			log.Printf("Shutting down: draining %d in-flight requests (timeout %v)", pending, time.Until(deadline).Round(time.Millisecond))
+		} else {
+			log.Printf("Shutting down: draining %d in-flight requests", pending)
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(s.services))
+		for i, svc := range s.services {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = svc.Shutdown(ctx)
+			}()
+		}
+		wg.Wait()
+
+		if left := s.tracker.n.Load(); left > 0 {
+			log.Printf("Shutdown timed out: drained %d requests, abandoned %d", pending-left, left)
+		} else {
+			log.Printf("Shutdown complete: drained %d requests", pending)
+		}
+		if s.flushTraces != nil {
+			s.flushTraces()
+		}
+		if s.srv.flushMetrics != nil {
+			s.srv.flushMetrics()
+		}
+		if s.srv.accessLog != nil {
+			s.srv.accessLog.Close()
+		}
+		s.shutdownErr = errors.Join(errs...)
+	})
+	return s.shutdownErr
+}
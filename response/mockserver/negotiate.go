@@ -0,0 +1,169 @@
+package mockserver
+
+import (
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Formats the mock response can be sent in.
+const (
+	formatJSON     = "json"
+	formatXML      = "xml"
+	formatProtobuf = "protobuf"
+	formatText     = "text"
+)
+
+// formatTypes lists the media types of each format, in the order of
+// preference used when an Accept header ranks several of them equally. The
+// first one is sent as Content-Type.
+var formatTypes = []struct {
+	format string
+	types  []string
+}{
+	{formatJSON, []string{"application/json"}},
+	{formatXML, []string{"application/xml", "text/xml"}},
+	{formatProtobuf, []string{"application/x-protobuf", "application/protobuf"}},
+	{formatText, []string{"text/plain"}},
+}
+
+// negotiateFormat picks the format of the mock response from ?format= or
+// else the Accept header, defaulting to JSON. It returns false if the client
+// accepts none of the formats.
+func negotiateFormat(r *http.Request) (string, bool) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		for _, ft := range formatTypes {
+			if ft.format == f {
+				return f, true
+			}
+		}
+		return "", false
+	}
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return formatJSON, true
+	}
+
+	best, bestQ := "", 0.0
+	for _, ft := range formatTypes {
+		q := 0.0
+		for _, t := range ft.types {
+			q = max(q, acceptQuality(accept, t))
+		}
+		if q > bestQ {
+			best, bestQ = ft.format, q
+		}
+	}
+	return best, best != ""
+}
+
+// acceptQuality returns the quality an Accept header gives to a media type,
+// using the most specific matching range.
+func acceptQuality(accept, mediaType string) float64 {
+	major, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		var s int
+		switch mt {
+		case mediaType:
+			s = 2
+		case major + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = 1, s
+			if v, err := strconv.ParseFloat(params["q"], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return q
+}
+
+// mockETagFor returns the ETag of the mock response in format.
+func mockETagFor(format string) string {
+	if format == formatJSON {
+		return mockETag
+	}
+	return strings.TrimSuffix(mockETag, `"`) + "-" + format + `"`
+}
+
+// writeMockAs sends the mock response in format. Only JSON is pre-encoded;
+// the other formats are encoded on every request, so their cost shows up in
+// the latency metrics.
+func writeMockAs(w http.ResponseWriter, status int, format string) {
+	var body []byte
+	var err error
+	switch format {
+	case formatJSON:
+		writeMock(w, status)
+		return
+	case formatXML:
+		body, err = xml.Marshal(newMockXML(mockResponse))
+	case formatProtobuf:
+		var st *structpb.Struct
+		if st, err = structpb.NewStruct(toAnyMap(mockResponse)); err == nil {
+			body, err = proto.Marshal(st)
+		}
+	case formatText:
+		var b strings.Builder
+		for _, k := range slices.Sorted(maps.Keys(mockResponse)) {
+			fmt.Fprintf(&b, "%s: %s\n", k, mockResponse[k])
+		}
+		body = []byte(b.String())
+	}
+	if err != nil {
+		http.Error(w, "encoding response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, ft := range formatTypes {
+		if ft.format == format {
+			w.Header().Set("Content-Type", ft.types[0])
+		}
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// mockXML renders a flat map as <response><key>value</key>...</response>.
+type mockXML struct {
+	XMLName xml.Name   `xml:"response"`
+	Fields  []xmlField `xml:",any"`
+}
+
+type xmlField struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+func newMockXML(m map[string]string) mockXML {
+	var x mockXML
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		x.Fields = append(x.Fields, xmlField{XMLName: xml.Name{Local: k}, Value: m[k]})
+	}
+	return x
+}
+
+func toAnyMap(m map[string]string) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,166 @@
+package mockserver
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+
+	"server/metrics"
+)
+
+// serverOrigin matches the scheme and host of a server URL in a spec.
+var serverOrigin = regexp.MustCompile(`^[^/]*//[^/]*`)
+
+// openAPIValidator rejects requests that do not follow an OpenAPI 3 spec:
+// unknown paths get 404, unknown methods 405, and requests with invalid
+// parameters or bodies 400, all with the violations in a JSON body. Valid
+// requests are passed on to be mocked as usual.
+type openAPIValidator struct {
+	router routers.Router
+}
+
+// newOpenAPIValidator loads and checks the spec in path. The hosts of its
+// servers are dropped so that requests to the mock match whatever address
+// it runs on; their base paths (e.g. /v1) still apply.
+func newOpenAPIValidator(path string) (*openAPIValidator, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, err
+	}
+	for _, s := range doc.Servers {
+		s.URL = serverOrigin.ReplaceAllString(s.URL, "")
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &openAPIValidator{router: router}, nil
+}
+
+// openAPIViolation is one reason a request does not follow the spec.
+type openAPIViolation struct {
+	// In is where the problem is: path, query, header, cookie or body.
+	In string `json:"in"`
+	// Name is the parameter, or the JSON pointer into the body, at fault.
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+type openAPIError struct {
+	Error      string             `json:"error"`
+	Operation  string             `json:"operation,omitempty"`
+	Violations []openAPIViolation `json:"violations"`
+}
+
+func (v *openAPIValidator) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route, params, err := v.router.FindRoute(r)
+		if err != nil {
+			status, reason := http.StatusNotFound, "path"
+			if errors.Is(err, routers.ErrMethodNotAllowed) {
+				status, reason = http.StatusMethodNotAllowed, "method"
+			}
+			metrics.OpenAPIFailure("unknown", reason)
+			writeJSON(w, status, openAPIError{
+				Error:      "request does not match the OpenAPI spec",
+				Violations: []openAPIViolation{{In: "path", Message: err.Error()}},
+			})
+			return
+		}
+
+		operation := r.Method + " " + route.Path
+		err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: params,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError: true,
+				// The mock has its own authentication scenarios; the
+				// spec's security schemes are not enforced.
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		})
+		if err != nil {
+			violations := openAPIViolations(err)
+			metrics.OpenAPIFailure(operation, openAPIReason(violations[0]))
+			writeJSON(w, http.StatusBadRequest, openAPIError{
+				Error:      "request does not match the OpenAPI spec",
+				Operation:  operation,
+				Violations: violations,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// openAPIViolations flattens the errors returned by the request validation.
+// It looks at their types rather than using errors.As, which would only find
+// the first of several errors in a MultiError.
+func openAPIViolations(err error) []openAPIViolation {
+	if multi, ok := err.(openapi3.MultiError); ok {
+		var out []openAPIViolation
+		for _, e := range multi {
+			out = append(out, openAPIViolations(e)...)
+		}
+		return out
+	}
+
+	reqErr, ok := err.(*openapi3filter.RequestError)
+	if !ok {
+		return []openAPIViolation{{In: "request", Message: err.Error()}}
+	}
+	// Several problems in one parameter or body are nested in the same
+	// way as the top-level ones.
+	if multi, ok := reqErr.Err.(openapi3.MultiError); ok {
+		var out []openAPIViolation
+		for _, e := range multi {
+			out = append(out, openAPIViolations(&openapi3filter.RequestError{
+				Parameter: reqErr.Parameter, RequestBody: reqErr.RequestBody, Reason: reqErr.Reason, Err: e,
+			})...)
+		}
+		return out
+	}
+
+	v := openAPIViolation{In: "body", Message: reqErr.Reason}
+	if p := reqErr.Parameter; p != nil {
+		v.In, v.Name = p.In, p.Name
+	}
+	if schemaErr, ok := reqErr.Err.(*openapi3.SchemaError); ok {
+		// The full schema error embeds the whole schema; the reason and
+		// the location are enough to find the problem.
+		v.Message = schemaErr.Reason
+		if v.In == "body" {
+			v.Name = "/" + strings.Join(schemaErr.JSONPointer(), "/")
+		}
+	} else if reqErr.Err != nil {
+		v.Message = reqErr.Err.Error()
+	}
+	return []openAPIViolation{v}
+}
+
+// openAPIReason is the metric reason for a violation.
+func openAPIReason(v openAPIViolation) string {
+	switch v.In {
+	case "body":
+		return "body"
+	case "request":
+		return "request"
+	default:
+		return "parameter"
+	}
+}
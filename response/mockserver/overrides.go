@@ -0,0 +1,62 @@
+package mockserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxOverrideDelay bounds the delay a single request may ask for.
+const maxOverrideDelay = 5 * time.Minute
+
+// overrides are per-request behaviour changes requested by the client through
+// query parameters (?delay=200ms&status=503&size=64kb) or the equivalent
+// x-inject-delay, x-inject-status and x-inject-size headers. Query parameters
+// win when both are present.
+type overrides struct {
+	delay    time.Duration
+	hasDelay bool
+	// status is 0 when not overridden.
+	status  int
+	size    int64
+	hasSize bool
+}
+
+// overrideValue returns the override called name from the query string, or
+// from the x-inject-<name> header.
+func overrideValue(r *http.Request, name string) string {
+	if v := r.URL.Query().Get(name); v != "" {
+		return v
+	}
+	return r.Header.Get("x-inject-" + name)
+}
+
+// parseOverrides extracts the overrides from r.
+func parseOverrides(r *http.Request) (overrides, error) {
+	var ov overrides
+	get := func(name string) string { return overrideValue(r, name) }
+
+	if v := get("delay"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || d > maxOverrideDelay {
+			return ov, fmt.Errorf("invalid delay %q (want a duration up to %v)", v, maxOverrideDelay)
+		}
+		ov.delay, ov.hasDelay = d, true
+	}
+	if v := get("status"); v != "" {
+		code, err := strconv.Atoi(v)
+		if err != nil || code < 200 || code > 599 {
+			return ov, fmt.Errorf("invalid status %q (want 200-599)", v)
+		}
+		ov.status = code
+	}
+	if v := get("size"); v != "" {
+		n, err := parseSize(v)
+		if err != nil {
+			return ov, err
+		}
+		ov.size, ov.hasSize = n, true
+	}
+	return ov, nil
+}
@@ -0,0 +1,223 @@
+package mockserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxPayloadSize bounds generated payloads so a single request cannot make
+// the server stream forever.
+const maxPayloadSize = 1 << 30
+
+// payloadGenerator produces response bodies of arbitrary size. Bodies are
+// built by repeating one block of pseudo-random printable characters generated
+// from a fixed seed, so every payload of a given size is byte-for-byte
+// identical across requests and restarts, and the block stays hot in cache.
+type payloadGenerator struct {
+	seed  uint64
+	chunk []byte
+}
+
+func newPayloadGenerator(seed uint64) *payloadGenerator {
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	rng := rand.New(rand.NewPCG(seed, seed))
+	chunk := make([]byte, 64<<10)
+	for i := range chunk {
+		chunk[i] = chars[rng.IntN(len(chars))]
+	}
+	return &payloadGenerator{seed: seed, chunk: chunk}
+}
+
+// etag identifies the payload of n bytes for caches.
+func (p *payloadGenerator) etag(n int64) string {
+	return fmt.Sprintf(`"p%x-%x"`, p.seed, n)
+}
+
+// write sends a generated body of exactly n bytes with the given status code.
+func (p *payloadGenerator) write(w http.ResponseWriter, status int, n int64) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	w.WriteHeader(status)
+	p.writeBody(w, 0, n)
+}
+
+// serve sends a successful generated body of n bytes, or the part of it asked
+// for with a Range header as 206 Partial Content. Only single byte ranges are
+// supported; requests for several ranges get the whole body.
+func (p *payloadGenerator) serve(w http.ResponseWriter, r *http.Request, n int64) {
+	w.Header().Set("Accept-Ranges", "bytes")
+	spec := r.Header.Get("Range")
+	if spec == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		p.write(w, http.StatusOK, n)
+		return
+	}
+	// A Range conditional on a different version gets the full body.
+	if ir := r.Header.Get("If-Range"); ir != "" && ir != p.etag(n) {
+		p.write(w, http.StatusOK, n)
+		return
+	}
+	start, end, err := parseRange(spec, n)
+	if err == errMultiRange {
+		p.write(w, http.StatusOK, n)
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", n))
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, n))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	p.writeBody(w, start, end-start+1)
+}
+
+// writeBody writes n bytes of the generated body starting at offset off.
+func (p *payloadGenerator) writeBody(w io.Writer, off, n int64) {
+	size := int64(len(p.chunk))
+	for n > 0 {
+		from := off % size
+		chunk := p.chunk[from:min(size, from+n)]
+		written, err := w.Write(chunk)
+		if err != nil {
+			// The client went away; nothing more to do.
+			return
+		}
+		off += int64(written)
+		n -= int64(written)
+	}
+}
+
+var errMultiRange = errors.New("multiple ranges")
+
+// parseRange parses a Range header with a single byte range for a body of
+// size bytes and returns the first and last byte offsets.
+func parseRange(spec string, size int64) (int64, int64, error) {
+	ranges, ok := strings.CutPrefix(spec, "bytes=")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range %q (only bytes ranges are supported)", spec)
+	}
+	if strings.Contains(ranges, ",") {
+		return 0, 0, errMultiRange
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(ranges), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range %q", spec)
+	}
+	if first == "" {
+		// "-n" is the last n bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, fmt.Errorf("unsatisfiable range %q", spec)
+		}
+		return max(size-n, 0), size - 1, nil
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, fmt.Errorf("unsatisfiable range %q", spec)
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, fmt.Errorf("invalid range %q", spec)
+		}
+		end = min(end, size-1)
+	}
+	return start, end, nil
+}
+
+// sizeRange is a closed range of payload sizes. The zero value means "no
+// generated payload".
+type sizeRange struct {
+	min, max int64
+}
+
+// parseSizeRange parses either a single size ("4kb") or a range
+// ("1kb..1mb").
+func parseSizeRange(s string) (sizeRange, error) {
+	if s == "" {
+		return sizeRange{}, nil
+	}
+	lo, hi, isRange := strings.Cut(s, "..")
+	from, err := parseSize(lo)
+	if err != nil {
+		return sizeRange{}, err
+	}
+	if !isRange {
+		return sizeRange{from, from}, nil
+	}
+	to, err := parseSize(hi)
+	if err != nil {
+		return sizeRange{}, err
+	}
+	if to < from {
+		return sizeRange{}, fmt.Errorf("invalid size range %q: upper bound is below lower bound", s)
+	}
+	return sizeRange{from, to}, nil
+}
+
+// String formats the range in the syntax accepted by parseSizeRange, in bytes.
+func (r sizeRange) String() string {
+	if r.min == r.max {
+		return strconv.FormatInt(r.min, 10)
+	}
+	return fmt.Sprintf("%d..%d", r.min, r.max)
+}
+
+// enabled reports whether a payload size was configured.
+func (r sizeRange) enabled() bool {
+	return r.max > 0
+}
+
+// sample returns a size drawn uniformly from the range.
+func (r sizeRange) sample() int64 {
+	if r.max <= r.min {
+		return r.min
+	}
+	return r.min + rand.Int64N(r.max-r.min+1)
+}
+
+// sizeUnits maps the suffixes accepted by parseSize to their multipliers.
+var sizeUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	// Longest suffixes first so "kb" is not mistaken for "b".
+	{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+	{"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10},
+	{"b", 1},
+}
+
+// parseSize parses a byte size such as "512", "64kb" or "1MB" of at most
+// maxPayloadSize. Units are powers of 1024.
+func parseSize(s string) (int64, error) {
+	return parseSizeUpTo(s, maxPayloadSize)
+}
+
+// parseSizeUpTo is parseSize with a limit of max bytes.
+func parseSizeUpTo(s string, max int64) (int64, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(str, u.suffix) {
+			str = strings.TrimSuffix(str, u.suffix)
+			mult = u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n > max/mult {
+		return 0, fmt.Errorf("size %q exceeds the %d byte limit", s, max)
+	}
+	return n * mult, nil
+}
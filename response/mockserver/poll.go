@@ -0,0 +1,107 @@
+package mockserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxPollTimeout bounds how long a single /poll request may be held.
+const maxPollTimeout = 5 * time.Minute
+
+// pollEvents simulates a data source for long-polling clients: a new event
+// becomes available every interval and wakes every waiting poller at once.
+type pollEvents struct {
+	mu    sync.Mutex
+	seq   int64
+	ready chan struct{} // closed when the next event is available
+}
+
+func newPollEvents(interval time.Duration) *pollEvents {
+	p := &pollEvents{ready: make(chan struct{})}
+	go func() {
+		for range time.Tick(interval) {
+			p.mu.Lock()
+			p.seq++
+			close(p.ready)
+			p.ready = make(chan struct{})
+			p.mu.Unlock()
+		}
+	}()
+	return p
+}
+
+// next returns a channel that is closed when the next event is available.
+func (p *pollEvents) next() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ready
+}
+
+// last returns the sequence number of the latest event.
+func (p *pollEvents) last() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.seq
+}
+
+// pollResponse is the body sent when a /poll request gets data.
+type pollResponse struct {
+	Event  int64     `json:"event"`
+	Time   time.Time `json:"time"`
+	Waited string    `json:"waited"`
+}
+
+// pollHandler holds the request open until the next event (every
+// -poll-interval, or after ?after=D for this request only) and answers 200,
+// or answers 204 No Content once ?timeout=D (default -poll-timeout) passes
+// without one.
+func (s *server) pollHandler(w http.ResponseWriter, r *http.Request) {
+	timeout, after, err := parsePollParams(r, s.cfg.pollTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
+	ready := s.poll.next()
+	if after >= 0 {
+		own := make(chan struct{})
+		t := time.AfterFunc(after, func() { close(own) })
+		defer t.Stop()
+		ready = own
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-ready:
+		writeJSON(w, http.StatusOK, pollResponse{Event: s.poll.last(), Time: time.Now(), Waited: time.Since(start).String()})
+	case <-t.C:
+		w.WriteHeader(http.StatusNoContent)
+	case <-r.Context().Done():
+	}
+}
+
+// parsePollParams returns the timeout and, if ?after is given, the
+// per-request delay until data is available (-1 otherwise).
+func parsePollParams(r *http.Request, defTimeout time.Duration) (time.Duration, time.Duration, error) {
+	q := r.URL.Query()
+	timeout, after := defTimeout, time.Duration(-1)
+	if v := q.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxPollTimeout {
+			return 0, 0, fmt.Errorf("invalid timeout %q (want a duration up to %v)", v, maxPollTimeout)
+		}
+		timeout = d
+	}
+	if v := q.Get("after"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || d > maxPollTimeout {
+			return 0, 0, fmt.Errorf("invalid after %q (want a duration up to %v)", v, maxPollTimeout)
+		}
+		after = d
+	}
+	return timeout, after, nil
+}
@@ -0,0 +1,131 @@
+package mockserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// problemInjected is the problem type of errors injected on purpose; other
+// errors use about:blank, whose title is the status text.
+const problemInjected = "urn:mock-server:problem:injected-error"
+
+// maxProblemDetail bounds how much of an error body becomes the detail.
+const maxProblemDetail = 4 << 10
+
+// problem is an RFC 9457 (formerly 7807) problem details object.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type problemKey struct{}
+
+// problemsEnabled reports whether errors for r are sent as problem details.
+func problemsEnabled(r *http.Request) bool {
+	on, _ := r.Context().Value(problemKey{}).(bool)
+	return on
+}
+
+// writeProblem sends an application/problem+json response for r.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, typ, detail string) {
+	p := problem{
+		Type:      typ,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.RequestURI(),
+		RequestID: r.Header.Get("X-Request-Id"),
+	}
+	body, _ := json.MarshalIndent(p, "", "  ")
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	h.Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+// problemDetails sends injected errors as problem details and, when rewrite
+// is set, turns the plain-text (http.Error) or empty error responses of the
+// rest of the server into problem details too, with the text as detail.
+// Error bodies in other formats are left alone.
+func problemDetails(rewrite bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), problemKey{}, true))
+		if !rewrite {
+			next.ServeHTTP(w, r)
+			return
+		}
+		pw := &problemWriter{ResponseWriter: w, r: r}
+		next.ServeHTTP(pw, r)
+		if pw.status != 0 {
+			detail := strings.TrimSpace(pw.detail.String())
+			if pw.Header().Get("Content-Encoding") != "" {
+				// The text was compressed on its way out.
+				detail = ""
+			}
+			writeProblem(pw.ResponseWriter, r, pw.status, "about:blank", detail)
+		}
+	})
+}
+
+// problemWriter holds back plain-text error responses so they can be
+// replaced by problem details.
+type problemWriter struct {
+	http.ResponseWriter
+	r *http.Request
+	// status is the error being replaced, or 0.
+	status int
+	detail bytes.Buffer
+	wrote  bool
+}
+
+func (pw *problemWriter) WriteHeader(code int) {
+	if pw.wrote {
+		return
+	}
+	if code >= 400 && plainOrEmpty(pw.Header().Get("Content-Type")) {
+		pw.status, pw.wrote = code, true
+		return
+	}
+	pw.wrote = code >= 200
+	pw.ResponseWriter.WriteHeader(code)
+}
+
+func (pw *problemWriter) Write(b []byte) (int, error) {
+	if !pw.wrote {
+		pw.WriteHeader(http.StatusOK)
+	}
+	if pw.status != 0 {
+		pw.detail.Write(b[:min(len(b), max(0, maxProblemDetail-pw.detail.Len()))])
+		return len(b), nil
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+func (pw *problemWriter) Flush() {
+	if pw.status == 0 {
+		http.NewResponseController(pw.ResponseWriter).Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (pw *problemWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+func plainOrEmpty(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	return mt == "text/plain"
+}
@@ -0,0 +1,127 @@
+package mockserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"server/metrics"
+)
+
+// parseUpstream parses the URL of a backend to proxy to.
+func parseUpstream(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http:// or https:// URL", s)
+	}
+	return u, nil
+}
+
+// newUpstreamProxy returns a reverse proxy to target. Its requests to target
+// show up in the upstream metrics under name, and requests that get no
+// response at all are answered with 502.
+func newUpstreamProxy(name string, target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			stripInjectHeaders(pr.Out.Header)
+		},
+		Transport: &upstreamTransport{name: name, next: http.DefaultTransport},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if r.Context().Err() != nil {
+				// The client went away; there is nobody to answer.
+				return
+			}
+			log.Printf("Proxy: %s %s to %s: %v", r.Method, r.URL.Path, name, err)
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": "upstream request failed: " + err.Error()})
+		},
+	}
+}
+
+// stripInjectHeaders removes the x-inject-* headers, which are meant for
+// this server only, before a request is forwarded.
+func stripInjectHeaders(h http.Header) {
+	for name := range h {
+		if strings.HasPrefix(name, "X-Inject-") {
+			h.Del(name)
+		}
+	}
+}
+
+// upstreamTransport times the requests sent to an upstream.
+type upstreamTransport struct {
+	name string
+	next http.RoundTripper
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracer.Start(req.Context(), "upstream "+t.name, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	status := 0
+	if err == nil {
+		status = resp.StatusCode
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	} else {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	elapsed := time.Since(start)
+	metrics.UpstreamRequest(t.name, req.Method, status, elapsed)
+	addTiming(req.Context(), "upstream", t.name, elapsed)
+	return resp, err
+}
+
+// proxyHandler replaces the mock response with -upstream's when it is set.
+// The injected delays and errors, including the per-request ?delay= and
+// ?status= overrides, still apply, so the server works as a chaos proxy in
+// front of a real dependency. Requests are mirrored to -mirror, if set,
+// before any fault is injected.
+func (s *server) proxyHandler(w http.ResponseWriter, r *http.Request) {
+	ov, err := parseOverrides(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.mirror != nil {
+		s.mirror.send(r)
+	}
+	b := s.behavior.Load()
+	inj := s.inject(b)
+	delay, source := inj.delay, "config"
+	if ov.hasDelay {
+		delay, source = ov.delay, "override"
+	}
+	metrics.InjectedDelay(source, delay)
+	if !injectDelay(r.Context(), delay) {
+		return
+	}
+	if ov.status != 0 {
+		metrics.InjectedError("override", ov.status)
+		b.errors.write(w, r, ov.status)
+		return
+	}
+	if inj.status != 0 {
+		metrics.InjectedError(inj.cause, inj.status)
+		b.errors.write(w, r, inj.status)
+		return
+	}
+	s.proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,60 @@
+package mockserver
+
+import (
+	"math"
+	"time"
+
+	"server/metrics"
+)
+
+// latencyRamp adds latency that grows over the server's lifetime, so that
+// trend detection in clients and alerts can be checked. Linear ramps add rate
+// every interval; exponential ones multiply the extra latency by factor every
+// interval, reaching rate after the first.
+type latencyRamp struct {
+	start       time.Time
+	rate        time.Duration
+	interval    time.Duration
+	exponential bool
+	factor      float64
+	// max caps the extra latency; 0 means no cap.
+	max time.Duration
+}
+
+// newLatencyRamp starts a ramp now and reports its current value in the
+// metrics, or returns nil when rate is 0.
+func newLatencyRamp(rate, interval time.Duration, exponential bool, factor float64, max time.Duration) *latencyRamp {
+	if rate <= 0 {
+		return nil
+	}
+	r := &latencyRamp{
+		start:       time.Now(),
+		rate:        rate,
+		interval:    interval,
+		exponential: exponential,
+		factor:      factor,
+		max:         max,
+	}
+	metrics.LatencyRamp(func() time.Duration { return r.extra() })
+	return r
+}
+
+// extra returns the latency the ramp adds right now.
+func (r *latencyRamp) extra() time.Duration {
+	if r == nil {
+		return 0
+	}
+	steps := float64(time.Since(r.start)) / float64(r.interval)
+	d := float64(r.rate) * steps
+	if r.exponential {
+		d = float64(r.rate) * (math.Pow(r.factor, steps) - 1) / (r.factor - 1)
+	}
+	if r.max > 0 && d > float64(r.max) {
+		return r.max
+	}
+	// Uncapped exponential ramps overflow a Duration after a while.
+	if d >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,122 @@
+package mockserver
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"server/metrics"
+)
+
+// clientIdleTimeout is how long a client's token bucket is kept after its
+// last request.
+const clientIdleTimeout = 3 * time.Minute
+
+// rateLimiter rejects requests beyond a token-bucket rate with 429 Too Many
+// Requests and a Retry-After header. There is an optional global bucket and
+// an optional bucket per client IP; a request must get a token from both.
+type rateLimiter struct {
+	global *rate.Limiter // nil when there is no global limit
+
+	perClient      rate.Limit // 0 when there is no per-client limit
+	perClientBurst int
+
+	mu      sync.Mutex
+	clients map[string]*clientBucket
+}
+
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter returns a limiter allowing globalRate requests per second
+// overall and clientRate per client IP, each with its own burst size. A rate
+// of 0 disables that limit. A burst below 1 is raised to 1.
+func newRateLimiter(globalRate float64, globalBurst int, clientRate float64, clientBurst int) *rateLimiter {
+	rl := &rateLimiter{
+		perClient:      rate.Limit(clientRate),
+		perClientBurst: max(clientBurst, 1),
+		clients:        make(map[string]*clientBucket),
+	}
+	if globalRate > 0 {
+		rl.global = rate.NewLimiter(rate.Limit(globalRate), max(globalBurst, 1))
+	}
+	if clientRate > 0 {
+		go rl.evictIdle()
+	}
+	return rl
+}
+
+func (rl *rateLimiter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if wait, limit := rl.reserve(clientIP(r)); wait > 0 {
+			metrics.Throttled(limit)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "rate limit exceeded"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reserve takes a token for a request from ip. If one is not available it
+// returns how long the client should wait and which limit ("client" or
+// "global") was hit, and no token is consumed.
+func (rl *rateLimiter) reserve(ip string) (time.Duration, string) {
+	now := time.Now()
+	var client *rate.Reservation
+	if rl.perClient > 0 {
+		client = rl.client(ip, now).ReserveN(now, 1)
+		if d := client.DelayFrom(now); d > 0 {
+			client.CancelAt(now)
+			return d, "client"
+		}
+	}
+	if rl.global != nil {
+		global := rl.global.ReserveN(now, 1)
+		if d := global.DelayFrom(now); d > 0 {
+			global.CancelAt(now)
+			if client != nil {
+				client.CancelAt(now)
+			}
+			return d, "global"
+		}
+	}
+	return 0, ""
+}
+
+// client returns the token bucket for ip, creating it if needed.
+func (rl *rateLimiter) client(ip string, now time.Time) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	c, ok := rl.clients[ip]
+	if !ok {
+		c = &clientBucket{limiter: rate.NewLimiter(rl.perClient, rl.perClientBurst)}
+		rl.clients[ip] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// evictIdle periodically forgets clients that have been quiet for
+// clientIdleTimeout, which also resets their buckets to full.
+func (rl *rateLimiter) evictIdle() {
+	for now := range time.Tick(clientIdleTimeout / 3) {
+		rl.mu.Lock()
+		for ip, c := range rl.clients {
+			if now.Sub(c.lastSeen) > clientIdleTimeout {
+				delete(rl.clients, ip)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
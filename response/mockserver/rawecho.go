@@ -0,0 +1,188 @@
+package mockserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"server/metrics"
+)
+
+// tcpEchoService writes back whatever it reads on every connection, for
+// transport-level benchmarks without HTTP in the way.
+type tcpEchoService struct {
+	addr string
+	lc   net.ListenConfig
+
+	mu     sync.Mutex
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newTCPEchoService(addr string, lc net.ListenConfig) *tcpEchoService {
+	return &tcpEchoService{addr: addr, lc: lc, conns: make(map[net.Conn]struct{})}
+}
+
+func (s *tcpEchoService) Listen(ctx context.Context) error {
+	ln, err := listen(ctx, s.lc, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		ln.Close()
+		return http.ErrServerClosed
+	}
+	s.ln = ln
+	return nil
+}
+
+func (s *tcpEchoService) localAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+func (s *tcpEchoService) Serve() error {
+	s.mu.Lock()
+	ln := s.ln
+	s.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return http.ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+func (s *tcpEchoService) serve(conn net.Conn) {
+	metrics.EchoConnOpened()
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		metrics.EchoConnClosed()
+		s.wg.Done()
+	}()
+	n, err := io.Copy(conn, conn)
+	metrics.EchoBytes("tcp", n)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("TCP echo: %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// Shutdown stops accepting connections and waits for the open ones to be
+// closed by their clients, closing them itself when ctx is done.
+func (s *tcpEchoService) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// udpEchoService sends every datagram it receives back to its sender.
+type udpEchoService struct {
+	addr string
+	lc   net.ListenConfig
+
+	mu     sync.Mutex
+	conn   net.PacketConn
+	closed bool
+}
+
+func (s *udpEchoService) Listen(ctx context.Context) error {
+	conn, err := s.lc.ListenPacket(ctx, "udp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		conn.Close()
+		return http.ErrServerClosed
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *udpEchoService) localAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.LocalAddr()
+}
+
+func (s *udpEchoService) Serve() error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	buf := make([]byte, 64<<10)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return http.ErrServerClosed
+			}
+			return err
+		}
+		if _, err := conn.WriteTo(buf[:n], addr); err != nil {
+			log.Printf("UDP echo: %s: %v", addr, err)
+			continue
+		}
+		metrics.EchoPacket(n)
+	}
+}
+
+// Shutdown closes the socket; datagrams have nothing to drain.
+func (s *udpEchoService) Shutdown(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// endpoint is a listener of a Server as announced once it is open.
+type endpoint struct {
+	// name identifies the listener: main, admin, unix, tls, http3, grpc,
+	// tcp-echo, udp-echo or the name of a -listen listener.
+	name string
+	// scheme is http or https for the HTTP listeners, empty otherwise.
+	scheme string
+	svc    service
+	// banner is the startup line, with %s for the bound address.
+	banner string
+}
+
+// announce adds svc to the listeners reported once the server is ready.
+func (s *Server) announce(name, scheme string, svc service, banner string) {
+	s.endpoints = append(s.endpoints, endpoint{name: name, scheme: scheme, svc: svc, banner: banner})
+}
+
+// readiness is the JSON line written once every listener is open, e.g.
+//
+//	{"status":"ready","pid":4242,"addr":"127.0.0.1:41234","port":41234,"url":"http://127.0.0.1:41234","listeners":[...]}
+//
+// With -port 0 it is the way to learn the ports the system picked.
+type readiness struct {
+	Status string `json:"status"`
+	PID    int    `json:"pid"`
+	// Addr, Port and URL are those of the main listener.
+	Addr      string          `json:"addr"`
+	Port      int             `json:"port,omitempty"`
+	URL       string          `json:"url,omitempty"`
+	Listeners []readyListener `json:"listeners"`
+}
+
+type readyListener struct {
+	Name    string `json:"name"`
+	Network string `json:"network"`
+	Addr    string `json:"addr"`
+	Port    int    `json:"port,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+func (s *Server) readiness() readiness {
+	r := readiness{Status: "ready", PID: os.Getpid(), Addr: s.Addr(), URL: s.URL()}
+	for _, e := range s.endpoints {
+		addr := e.svc.localAddr()
+		l := readyListener{Name: e.name, Network: addr.Network(), Addr: addr.String(), Port: addrPort(addr)}
+		if e.scheme != "" && l.Network != "unix" {
+			l.URL = e.scheme + "://" + dialAddr(addr)
+		}
+		if e.svc == service(s.primary) {
+			r.Port = l.Port
+		}
+		r.Listeners = append(r.Listeners, l)
+	}
+	return r
+}
+
+// dialAddr returns addr in a form clients can connect to: a wildcard host
+// becomes localhost.
+func dialAddr(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// addrPort returns the port of a TCP or UDP address, or 0.
+func addrPort(addr net.Addr) int {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.Port
+	case *net.UDPAddr:
+		return a.Port
+	}
+	return 0
+}
+
+// announceReady prints the startup banner, or the readiness line with
+// -ready-format=json, and writes the readiness line to -ready-fd and
+// -ready-file.
+func (s *Server) announceReady() error {
+	line, err := json.Marshal(s.readiness())
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if s.cfg.readyFormat == "json" {
+		s.out.Write(line)
+	} else {
+		for _, e := range s.endpoints {
+			fmt.Fprintf(s.out, e.banner, e.svc.localAddr())
+		}
+	}
+	if s.cfg.readyFD > 0 {
+		f := os.NewFile(uintptr(s.cfg.readyFD), "ready-fd")
+		_, err := f.Write(line)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("writing to -ready-fd %d: %w", s.cfg.readyFD, err)
+		}
+	}
+	if s.cfg.readyFile != "" {
+		if err := writeFileAtomic(s.cfg.readyFile, line); err != nil {
+			return fmt.Errorf("writing -ready-file: %w", err)
+		}
+	}
+	if s.cfg.envFile != "" {
+		if err := writeFileAtomic(s.cfg.envFile, envFile(s.readiness())); err != nil {
+			return fmt.Errorf("writing -env-file: %w", err)
+		}
+	}
+	return nil
+}
+
+// envFile renders r as shell variable assignments: MOCK_SERVER_ADDR,
+// MOCK_SERVER_PORT and MOCK_SERVER_URL for the main listener, and the same
+// with the listener name (e.g. MOCK_SERVER_ADMIN_PORT) for the others.
+func envFile(r readiness) []byte {
+	var b strings.Builder
+	set := func(key, value string) {
+		if value != "" && value != "0" {
+			fmt.Fprintf(&b, "%s=%s\n", key, shellQuote(value))
+		}
+	}
+	set("MOCK_SERVER_ADDR", r.Addr)
+	set("MOCK_SERVER_PORT", strconv.Itoa(r.Port))
+	set("MOCK_SERVER_URL", r.URL)
+	for _, l := range r.Listeners {
+		if l.Name == "main" {
+			continue
+		}
+		prefix := "MOCK_SERVER_" + envName(l.Name) + "_"
+		set(prefix+"ADDR", l.Addr)
+		set(prefix+"PORT", strconv.Itoa(l.Port))
+		set(prefix+"URL", l.URL)
+	}
+	return []byte(b.String())
+}
+
+// envName turns a listener name into the upper case letters, digits and
+// underscores of a variable name.
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// shellQuote single-quotes v unless it is made of characters that are safe
+// unquoted.
+func shellQuote(v string) string {
+	safe := strings.IndexFunc(v, func(r rune) bool {
+		return !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.:/[]@%+=,", r)
+	}) < 0
+	if safe {
+		return v
+	}
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
+
+// writeFileAtomic replaces the file at path with data, so that anyone
+// polling for it never sees it half written.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+package mockserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// recordedRequest is what the server saw of one request carrying an
+// X-Mgc-Test-Id header.
+type recordedRequest struct {
+	TestID        string    `json:"test_id"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Status        int       `json:"status"`
+	Received      time.Time `json:"received"`
+	Duration      duration  `json:"duration"`
+	RequestBytes  int64     `json:"request_bytes"`
+	ResponseBytes int64     `json:"response_bytes"`
+}
+
+// requestLog keeps the last max requests carrying an X-Mgc-Test-Id header,
+// indexed by test ID, so tests can check what actually reached the server
+// through /requests/{id} and /requests?since=.
+type requestLog struct {
+	mu  sync.Mutex
+	max int
+	// entries is a ring buffer; once full, next is the oldest entry.
+	entries []*recordedRequest
+	next    int
+	byID    map[string][]*recordedRequest
+}
+
+func newRequestLog(max int) *requestLog {
+	return &requestLog{max: max, byID: make(map[string][]*recordedRequest)}
+}
+
+func (l *requestLog) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Mgc-Test-Id")
+		if id == "" || controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		body := &countingBody{ReadCloser: r.Body}
+		r.Body = body
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		// Handlers that ignore the body still received Content-Length bytes.
+		reqBytes := max(body.n, r.ContentLength)
+		l.add(&recordedRequest{
+			TestID:        id,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Status:        rec.status,
+			Received:      start,
+			Duration:      duration(time.Since(start)),
+			RequestBytes:  reqBytes,
+			ResponseBytes: rec.bytes,
+		})
+	})
+}
+
+// add stores e, evicting the oldest entry once the log is full.
+func (l *requestLog) add(e *recordedRequest) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < l.max {
+		l.entries = append(l.entries, e)
+	} else {
+		old := l.entries[l.next]
+		if rest := l.byID[old.TestID][1:]; len(rest) > 0 {
+			l.byID[old.TestID] = rest
+		} else {
+			delete(l.byID, old.TestID)
+		}
+		l.entries[l.next] = e
+		l.next = (l.next + 1) % l.max
+	}
+	l.byID[e.TestID] = append(l.byID[e.TestID], e)
+}
+
+// get returns the requests recorded for a test ID, oldest first.
+func (l *requestLog) get(id string) []*recordedRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*recordedRequest(nil), l.byID[id]...)
+}
+
+// since returns the requests received after t, oldest first.
+func (l *requestLog) since(t time.Time) []*recordedRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	found := []*recordedRequest{}
+	for _, part := range [][]*recordedRequest{l.entries[l.next:], l.entries[:l.next]} {
+		for _, e := range part {
+			if e.Received.After(t) {
+				found = append(found, e)
+			}
+		}
+	}
+	return found
+}
+
+// requestsByIDHandler lists the requests recorded for the test ID in the
+// path, answering 404 if there are none.
+func (s *server) requestsByIDHandler(w http.ResponseWriter, r *http.Request) {
+	found := s.requests.get(r.PathValue("id"))
+	if len(found) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no requests recorded for this test ID"})
+		return
+	}
+	writeJSON(w, http.StatusOK, found)
+}
+
+// requestsHandler lists the recorded requests received after ?since=, which
+// is either an RFC 3339 timestamp or a duration back from now (e.g. 30s).
+// Without it every recorded request is listed.
+func (s *server) requestsHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r.URL.Query().Get("since"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.requests.since(since))
+}
+
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q (want an RFC 3339 timestamp or a duration)", s)
+}
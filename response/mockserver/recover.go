@@ -0,0 +1,62 @@
+package mockserver
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"server/metrics"
+)
+
+// recoverPanics turns a panic in next into a 500 response and logs the stack,
+// instead of letting net/http drop the connection. If the response has
+// already started the status can no longer change, so the connection is
+// aborted instead.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &headerRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			metrics.Panicked()
+			slog.Error("panic serving request",
+				"request_id", r.Header.Get("X-Request-Id"),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", fmt.Sprint(v),
+				"stack", string(debug.Stack()))
+			if rec.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// headerRecorder notes whether the response status has been sent.
+type headerRecorder struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rec *headerRecorder) WriteHeader(code int) {
+	rec.wroteHeader = true
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *headerRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *headerRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
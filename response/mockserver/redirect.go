@@ -0,0 +1,58 @@
+package mockserver
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// maxRedirects bounds the length of a /redirect chain.
+const maxRedirects = 100
+
+var redirectCodes = []int{
+	http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+	http.StatusTemporaryRedirect, http.StatusPermanentRedirect,
+}
+
+// redirectHandler answers /redirect/{n} with a redirect to /redirect/{n-1},
+// and /redirect/0 with the static JSON response, so a client following
+// redirects makes n extra requests. ?code= picks the redirect status (301,
+// 302, 303, 307 or 308; default 302) and ?absolute=true sends absolute
+// instead of relative Location URLs. The query string is kept along the
+// chain.
+func (s *server) redirectHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || n < 0 || n > maxRedirects {
+		http.Error(w, fmt.Sprintf("invalid redirect count %q (want 0 to %d)", r.PathValue("n"), maxRedirects), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	code := http.StatusFound
+	if v := q.Get("code"); v != "" {
+		c, err := strconv.Atoi(v)
+		if err != nil || !slices.Contains(redirectCodes, c) {
+			http.Error(w, fmt.Sprintf("invalid code %q (want 301, 302, 303, 307 or 308)", v), http.StatusBadRequest)
+			return
+		}
+		code = c
+	}
+	if n == 0 {
+		writeMock(w, http.StatusOK)
+		return
+	}
+
+	location := fmt.Sprintf("/redirect/%d", n-1)
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+	if v, _ := strconv.ParseBool(q.Get("absolute")); v {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		location = scheme + "://" + r.Host + location
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(code)
+}
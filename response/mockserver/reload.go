@@ -0,0 +1,135 @@
+package mockserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"server/metrics"
+)
+
+// routeTable serves the routes of the -config file ahead of the built-in
+// ones. Reloading the file swaps the whole table at once.
+type routeTable struct {
+	mux atomic.Pointer[http.ServeMux]
+}
+
+func (t *routeTable) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux := t.mux.Load()
+		if mux != nil && !controlPath(r.URL.Path) {
+			if _, pattern := mux.Handler(r); pattern != "" {
+				mux.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// buildRoutes returns a mux serving routes with the mock handler, each with
+// its own behaviour. Invalid or clashing patterns are reported as errors.
+func (s *server) buildRoutes(routes []routeSpec) (mux *http.ServeMux, err error) {
+	mux = http.NewServeMux()
+	for _, rt := range routes {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					err = fmt.Errorf("route %q: %v", rt.pattern, p)
+				}
+			}()
+			h := s.withBehavior(rt.behavior).mockHandler
+			mux.Handle(rt.pattern, s.routeChain(rt.name).then(http.HandlerFunc(h)))
+		}()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mux, nil
+}
+
+// reloadConfig re-reads the -config file and swaps in its routes and its
+// behaviour settings (delay, delay-distribution, delay-stddev, delay-max,
+// error-rate, error-codes and response-size), starting from the behaviour
+// the server started with. Command-line flags still take precedence. Other
+// settings need a restart.
+func (s *server) reloadConfig() (*behavior, error) {
+	b, routes, err := s.loadReloadable()
+	if err != nil {
+		metrics.ConfigReload(false)
+		return nil, err
+	}
+	mux, err := s.buildRoutes(routes)
+	if err != nil {
+		metrics.ConfigReload(false)
+		return nil, err
+	}
+
+	s.adminMu.Lock()
+	s.behavior.Store(b)
+	s.configRoutes.mux.Store(mux)
+	s.adminMu.Unlock()
+	metrics.ConfigReload(true)
+	log.Printf("Reloaded %s: %d routes", s.cfg.configFile, len(routes))
+	return b, nil
+}
+
+func (s *server) loadReloadable() (*behavior, []routeSpec, error) {
+	settings, routeDefs, err := readConfigFile(s.cfg.flags, s.cfg.configFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	b := s.cfg.behavior
+	for _, st := range settings {
+		if s.cfg.cmdLine[st.key] {
+			continue
+		}
+		known, err := setBehaviorOption(&b, st.key, strings.Join(st.values, ","))
+		if known && err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %s: %w", s.cfg.configFile, st.line, st.key, err)
+		}
+	}
+	if err := b.validate(); err != nil {
+		return nil, nil, err
+	}
+	var routes []routeSpec
+	for _, def := range routeDefs {
+		rt, err := parseRouteSpec(def, b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("route %q: %w", def["path"], err)
+		}
+		routes = append(routes, rt)
+	}
+	return &b, routes, nil
+}
+
+// watchConfig reloads the -config file whenever the process receives
+// SIGHUP. It never returns.
+func (s *server) watchConfig() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if _, err := s.reloadConfig(); err != nil {
+			log.Printf("ERROR reloading %s, keeping the current configuration: %v", s.cfg.configFile, err)
+		}
+	}
+}
+
+func (s *server) adminReload(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.configFile == "" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "the server was not started with -config"})
+		return
+	}
+	b, err := s.reloadConfig()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	log.Printf("Admin: configuration reloaded by %s", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, newBehaviorJSON(b))
+}
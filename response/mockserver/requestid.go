@@ -0,0 +1,26 @@
+package mockserver
+
+import (
+	"crypto/rand"
+	"net/http"
+)
+
+// withRequestID makes sure every request carries an ID in its X-Request-Id
+// header, so it shows up in the access logs and can be matched with client
+// logs. The ID is taken from X-Request-Id, then from the client's
+// X-Mgc-Test-Id, and generated if neither is set. It is echoed back in the
+// X-Request-Id response header.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if id == "" {
+			id = r.Header.Get("X-Mgc-Test-Id")
+		}
+		if id == "" {
+			id = rand.Text()
+		}
+		r.Header.Set("X-Request-Id", id)
+		w.Header().Set("X-Request-Id", id)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,206 @@
+package mockserver
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/metrics"
+)
+
+// maxCachedBody is the largest response body the response cache keeps.
+const maxCachedBody = 1 << 20
+
+// responseCache models a cache in front of the mock: a repeated GET is
+// answered from memory, without the injected delays and errors, until its
+// entry is ttl old. Entries are keyed by path, query and Accept header (the
+// mock's responses vary by format), and the least recently used are evicted
+// beyond size entries. Only complete 200 responses are cached, so streams and
+// failures always reach the handler. Requests with Cache-Control: no-cache
+// bypass the cache and refresh it, and requests with credentials (an
+// Authorization, Cookie or -auth-api-key-header header) bypass it without
+// refreshing it, as do responses that are private or set credentials.
+type responseCache struct {
+	ttl  time.Duration
+	size int
+	// apiKeyHeader carries credentials, like Authorization.
+	apiKeyHeader string
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru holds the entries, most recently used first.
+	lru *list.List
+}
+
+type cacheEntry struct {
+	key     string
+	header  http.Header
+	body    []byte
+	expires time.Time
+	stored  time.Time
+}
+
+func newResponseCache(ttl time.Duration, size int, apiKeyHeader string) *responseCache {
+	return &responseCache{ttl: ttl, size: size, apiKeyHeader: apiKeyHeader, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+func (c *responseCache) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" || r.Header.Get(c.apiKeyHeader) != "" {
+			metrics.CacheRequest("bypass")
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Listeners and tenants share the cache but not their responses.
+		listener, tenant := metrics.ListenerAndTenant(r)
+		key := listener + " " + tenant + " " + r.Method + " " + r.URL.RequestURI() + "\n" + r.Header.Get("Accept")
+		if r.Header.Get("Cache-Control") == "no-cache" {
+			metrics.CacheRequest("bypass")
+		} else if e := c.get(key); e != nil {
+			metrics.CacheRequest("hit")
+			c.serve(w, r, e)
+			return
+		} else {
+			metrics.CacheRequest("miss")
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		cw := &cachingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		if cw.status == http.StatusOK && !cw.uncacheable && storable(cw.header) {
+			now := time.Now()
+			c.put(&cacheEntry{key: key, header: cw.header, body: cw.body.Bytes(), stored: now, expires: now.Add(c.ttl)})
+		}
+	})
+}
+
+// storable reports whether a response with header h may be shared with
+// other clients: it is not private and sets no credentials.
+func storable(h http.Header) bool {
+	if h.Get("Set-Cookie") != "" || h.Get("WWW-Authenticate") != "" {
+		return false
+	}
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.ToLower(strings.TrimSpace(d))
+			if d == "private" || d == "no-store" || strings.HasPrefix(d, "private=") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// serve answers r from e, with 304 if its If-None-Match matches the cached
+// ETag. Headers the outer middleware already set, such as the request ID,
+// are kept.
+func (c *responseCache) serve(w http.ResponseWriter, r *http.Request, e *cacheEntry) {
+	h := w.Header()
+	for k, v := range e.header {
+		if _, ok := h[k]; !ok {
+			h[k] = v
+		}
+	}
+	h.Set("X-Cache", "HIT")
+	h.Set("Age", strconv.Itoa(int(time.Since(e.stored).Seconds())))
+	if etag := e.header.Get("Etag"); etag != "" && etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(e.body)
+}
+
+// get returns the live entry for key, or nil. An expired entry is evicted.
+func (c *responseCache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expires) {
+		c.remove(el, "expired")
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return e
+}
+
+func (c *responseCache) put(e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[e.key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back(), "capacity")
+	}
+	metrics.SetCacheEntries(c.lru.Len())
+}
+
+// remove evicts el for reason ("expired" or "capacity"). c.mu must be held.
+func (c *responseCache) remove(el *list.Element, reason string) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+	metrics.CacheEviction(reason)
+	metrics.SetCacheEntries(c.lru.Len())
+}
+
+// cachingWriter passes the response on while keeping a copy of it for the
+// cache.
+type cachingWriter struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+	// uncacheable is set for responses that are flushed or too big.
+	// Hijacked connections never get a status, so they are not cached
+	// either.
+	uncacheable bool
+}
+
+func (cw *cachingWriter) WriteHeader(code int) {
+	if cw.status == 0 && code >= 200 {
+		cw.status = code
+		cw.header = cw.Header().Clone()
+		cw.header.Del("X-Cache")
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cachingWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.uncacheable {
+		if cw.body.Len()+len(b) > maxCachedBody {
+			cw.uncacheable = true
+			cw.body = bytes.Buffer{}
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *cachingWriter) Flush() {
+	cw.uncacheable = true
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *cachingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
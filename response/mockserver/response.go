@@ -0,0 +1,356 @@
+package mockserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"server/metrics"
+)
+
+var (
+	// mockResponse is the body of the mock response.
+	mockResponse = map[string]string{
+		"status":  "ok",
+		"message": "This is a fast mock response!",
+	}
+	mockResponseBytes []byte
+	// mockETag identifies mockResponseBytes for caches.
+	mockETag string
+)
+
+func init() {
+	// init() runs once when the program starts.
+	// We marshal the mock response to JSON *once*
+	var err error
+	mockResponseBytes, err = json.Marshal(mockResponse)
+	if err != nil {
+		// If this fails, we can't run the server.
+		log.Fatalf("Fatal Error: Failed to marshal mock response: %v", err)
+	}
+	sum := sha256.Sum256(mockResponseBytes)
+	mockETag = `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// server holds the configuration and state shared by the handlers.
+type server struct {
+	cfg     *config
+	payload *payloadGenerator
+	poll    *pollEvents
+	auth    *authenticator
+	cache   cachePolicy
+	// requests, inspector, clients and series are nil when disabled.
+	requests  *requestLog
+	inspector *inspector
+	clients   *clientStats
+	series    *requestSeries
+	// degrade is nil without a degradation schedule.
+	degrade *degradation
+	ramp    *latencyRamp
+	// seq numbers the requests for the sequence rules.
+	seq atomic.Int64
+	// proxy replaces the mock response when -upstream is set.
+	proxy  *httputil.ReverseProxy
+	mirror *mirror
+	// configRoutes are the routes of the -config file.
+	configRoutes *routeTable
+	// graphql serves /graphql when -graphql is set.
+	graphql *graphqlMock
+	// stubs, openapi, compressor and accessLog are nil unless enabled by
+	// their flags.
+	stubs      *stubRouter
+	openapi    *openAPIValidator
+	compressor *compressor
+	accessLog  *rotatingFile
+	// rateLimiter, concurrency and responseCache are nil unless enabled
+	// by their flags, and shared by every listener so that the limits
+	// hold for the server as a whole.
+	rateLimiter   *rateLimiter
+	concurrency   *concurrencyLimiter
+	responseCache *responseCache
+	// httpMetrics records the requests of every route.
+	httpMetrics *metrics.Metrics
+	// flushMetrics is nil unless the request metrics are exported over
+	// OTLP.
+	flushMetrics func()
+	behavior     atomic.Pointer[behavior]
+	// done is closed when the server shuts down, stopping the file
+	// watchers.
+	done chan struct{}
+	// adminMu serialises admin updates so concurrent calls cannot lose
+	// each other's changes.
+	adminMu sync.Mutex
+}
+
+func newServer(cfg *config) (*server, error) {
+	s := &server{
+		cfg:     cfg,
+		done:    make(chan struct{}),
+		payload: newPayloadGenerator(cfg.payloadSeed),
+		poll:    newPollEvents(cfg.pollInterval),
+		auth:    newAuthenticator(cfg),
+		cache: cachePolicy{
+			etags:        cfg.etags,
+			cacheControl: cfg.cacheControl,
+		},
+	}
+	httpMetrics, flush, err := newHTTPMetrics(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("setting up the request metrics: %w", err)
+	}
+	s.httpMetrics = httpMetrics
+	s.flushMetrics = flush
+	if cfg.recordRequests > 0 {
+		s.requests = newRequestLog(cfg.recordRequests)
+	}
+	if cfg.upstream != nil {
+		s.proxy = newUpstreamProxy("primary", cfg.upstream)
+	}
+	if cfg.mirror != nil {
+		s.mirror = newMirror(cfg.mirror, cfg.mirrorRate, cfg.mirrorTimeout)
+	}
+	s.degrade = newDegradation(cfg.degradeEvery, cfg.degradeFor, cfg.degradeDelay, cfg.degradeStatus)
+	s.ramp = newLatencyRamp(cfg.rampRate, cfg.rampInterval, cfg.rampExponential, cfg.rampFactor, cfg.rampMax)
+	if cfg.graphqlFile != "" {
+		g, err := loadGraphQL(cfg.graphqlFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading GraphQL mocks: %w", err)
+		}
+		s.graphql = g
+	}
+	if cfg.clientStats > 0 {
+		s.clients = newClientStats(cfg.clientStats)
+	}
+	if cfg.statsWindow > 0 {
+		s.series = newRequestSeries(cfg.statsWindow)
+	}
+	if cfg.inspectSize > 0 {
+		s.inspector = newInspector(cfg.inspectSize, cfg.inspectMaxBody)
+	}
+	if cfg.rateLimit > 0 || cfg.clientRateLimit > 0 {
+		s.rateLimiter = newRateLimiter(cfg.rateLimit, cfg.rateBurst, cfg.clientRateLimit, cfg.clientRateBurst)
+	}
+	if cfg.maxConcurrent > 0 {
+		s.concurrency = newConcurrencyLimiter(cfg.maxConcurrent, cfg.queueSize, cfg.queueTimeout)
+	}
+	if cfg.responseCacheTTL > 0 {
+		s.responseCache = newResponseCache(cfg.responseCacheTTL, cfg.responseCacheSize, cfg.authAPIKeyHeader)
+	}
+	if cfg.lastModified {
+		s.cache.lastModified = time.Now().Truncate(time.Second)
+	}
+	if cfg.mocksFile != "" {
+		stubs, err := newStubRouter(cfg.mocksFile, s.httpMetrics)
+		if err != nil {
+			return nil, fmt.Errorf("loading mocks: %w", err)
+		}
+		s.stubs = stubs
+	}
+	if cfg.openAPISpec != "" {
+		v, err := newOpenAPIValidator(cfg.openAPISpec)
+		if err != nil {
+			return nil, fmt.Errorf("loading OpenAPI spec: %w", err)
+		}
+		s.openapi = v
+	}
+	if cfg.compress != "" {
+		c, err := newCompressor(cfg.compress, cfg.compressMinSize, cfg.compressLevel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -compress: %w", err)
+		}
+		s.compressor = c
+	}
+	if cfg.accessLog != "" {
+		out, err := openRotatingFile(cfg.accessLog, cfg.accessLogMaxSize, cfg.accessLogRotate)
+		if err != nil {
+			return nil, fmt.Errorf("opening access log: %w", err)
+		}
+		s.accessLog = out
+	}
+	initial := cfg.behavior
+	s.behavior.Store(&initial)
+	s.configRoutes = &routeTable{}
+	if len(cfg.routes) > 0 {
+		mux, err := s.buildRoutes(cfg.routes)
+		if err != nil {
+			return nil, fmt.Errorf("-config: %w", err)
+		}
+		s.configRoutes.mux.Store(mux)
+	}
+	return s, nil
+}
+
+// mockHandler is our high-performance request handler.
+func (s *server) mockHandler(w http.ResponseWriter, r *http.Request) {
+	// Read the request body like a real backend would.
+	if !drainBody(w, r) {
+		return
+	}
+
+	// 0. Apply any behaviour the client asked for on this request.
+	ov, err := parseOverrides(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	format, ok := negotiateFormat(r)
+	if !ok {
+		http.Error(w, "none of the json, xml, protobuf or text formats is acceptable", http.StatusNotAcceptable)
+		return
+	}
+
+	// 0a. Simulate a slower backend, giving up if the client goes away.
+	b := s.behavior.Load()
+	inj := s.inject(b)
+	delay, source := inj.delay, "config"
+	if ov.hasDelay {
+		delay, source = ov.delay, "override"
+	} else {
+		for _, e := range inj.downstream {
+			addTiming(r.Context(), e.name, e.desc, e.dur)
+		}
+	}
+	metrics.InjectedDelay(source, delay)
+	if !injectDelay(r.Context(), delay) {
+		return
+	}
+
+	// 0b. Fail requests on purpose, unless the client asked for a specific
+	// status.
+	status := http.StatusOK
+	if ov.status != 0 {
+		status = ov.status
+		if status >= 400 {
+			metrics.InjectedError("override", status)
+		}
+	} else if inj.status != 0 {
+		metrics.InjectedError(inj.cause, inj.status)
+		b.errors.write(w, r, inj.status)
+		return
+	}
+
+	// 0c. Generated payloads replace the JSON body entirely.
+	size, hasSize := ov.size, ov.hasSize
+	if !hasSize && b.responseSize.enabled() {
+		size, hasSize = b.responseSize.sample(), true
+	}
+	etag := mockETagFor(format)
+	if hasSize {
+		etag = s.payload.etag(size)
+	}
+
+	// 0d. Let clients and caches revalidate successful responses.
+	if status == http.StatusOK && s.cache.notModified(w, r, etag) {
+		return
+	}
+	if hasSize && status == http.StatusOK {
+		s.payload.serve(w, r, size)
+		return
+	}
+	if hasSize {
+		s.payload.write(w, status, size)
+		return
+	}
+	writeMockAs(w, status, format)
+}
+
+// writeMock sends the pre-computed JSON response with the given status.
+func writeMock(w http.ResponseWriter, status int) {
+	// 1. Set the content type header
+	w.Header().Set("Content-Type", "application/json")
+
+	// 2. Write the status code
+	w.WriteHeader(status)
+
+	// 3. Write the pre-computed response bytes.
+	// This is the fastest way to send a static response.
+	w.Write(mockResponseBytes)
+}
+
+// handler wraps mux, serving s's routes, in the stubs and the middleware
+// chain configured by the flags, listed from the outermost to the innermost.
+func (s *server) handler(mux *http.ServeMux) http.Handler {
+	cfg := s.cfg
+	var c chain
+	if cfg.otlpEndpoint != "" {
+		c.use(traceRequests)
+	}
+	c.use(withRequestID)
+	if cfg.problemJSON {
+		// Proxied responses are passed on as the upstream sent them.
+		c.use(func(h http.Handler) http.Handler { return problemDetails(s.proxy == nil, h) })
+	}
+	if s.accessLog != nil {
+		c.use((&clfLog{out: s.accessLog, combined: cfg.accessLogCombined}).wrap)
+	}
+	if cfg.ipFilter != nil {
+		c.use(cfg.ipFilter.wrap)
+	}
+	if cfg.serverTiming {
+		c.use(serverTiming)
+	}
+	if s.clients != nil {
+		c.use(s.clients.wrap)
+	}
+	if s.series != nil {
+		c.use(s.series.wrap)
+	}
+	if s.inspector != nil {
+		c.use(s.inspector.wrap)
+	}
+	if s.requests != nil {
+		c.use(s.requests.wrap)
+	}
+	if cfg.maxKeepAliveRequests > 0 {
+		c.use(func(h http.Handler) http.Handler { return limitKeepAlive(cfg.maxKeepAliveRequests, h) })
+	}
+	if cfg.requestTimeout > 0 {
+		c.use(func(h http.Handler) http.Handler { return requestDeadline(cfg.requestTimeout, h) })
+	}
+	if s.rateLimiter != nil {
+		c.use(s.rateLimiter.wrap)
+	}
+	if s.concurrency != nil {
+		c.use(s.concurrency.wrap)
+	}
+	c.use(
+		s.chaos,
+		func(h http.Handler) http.Handler { return throttleBandwidth(cfg.responseBandwidth, h) },
+	)
+	if s.compressor != nil {
+		c.use(s.compressor.wrap)
+	}
+	c.use(
+		(&expectContinue{mode: cfg.expectContinue, delay: cfg.expectContinueDelay, status: cfg.expectContinueStatus}).wrap,
+		(&bodyLimits{max: cfg.maxBodySize, validateJSON: cfg.validateJSON}).wrap,
+		recoverPanics,
+		s.leak,
+	)
+	if cfg.otlpEndpoint != "" {
+		c.use(func(h http.Handler) http.Handler { return tracePhase("handler", h) })
+	}
+	// Cached responses are still checked against the OpenAPI spec.
+	if s.openapi != nil {
+		c.use(s.openapi.wrap)
+	}
+	if s.responseCache != nil {
+		c.use(s.responseCache.wrap)
+	}
+	// Stubs from -mocks take precedence over the built-in routes, and so
+	// do the routes from -config, except in proxy mode.
+	if s.stubs != nil {
+		c.use(s.stubs.wrap)
+	}
+	if s.proxy == nil {
+		c.use(s.configRoutes.wrap)
+	}
+	return c.then(mux)
+}
@@ -0,0 +1,144 @@
+package mockserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+)
+
+// listenFDsEnv tells a restarted server how many listening sockets it
+// inherited from its predecessor, starting at file descriptor 3.
+const listenFDsEnv = "MOCK_LISTEN_FDS"
+
+// sockets tracks the listeners the server opened, so a restart can hand
+// them to the new process, and the ones it inherited and has not claimed yet.
+var sockets struct {
+	sync.Mutex
+	open      []net.Listener
+	inherited []net.Listener
+}
+
+func init() {
+	n, err := inheritedFDs()
+	if err != nil {
+		log.Printf("Ignoring inherited sockets: %v", err)
+		return
+	}
+	for i := range n {
+		f := os.NewFile(uintptr(3+i), "listener")
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			log.Printf("Ignoring inherited socket %d: %v", 3+i, err)
+			continue
+		}
+		if ul, ok := ln.(*net.UnixListener); ok {
+			// This process now owns the socket file.
+			ul.SetUnlinkOnClose(true)
+		}
+		sockets.inherited = append(sockets.inherited, ln)
+	}
+}
+
+// inheritedFDs returns the number of listening sockets passed down by a
+// previous server process, or by systemd socket activation.
+func inheritedFDs() (int, error) {
+	if v := os.Getenv(listenFDsEnv); v != "" {
+		os.Unsetenv(listenFDsEnv)
+		return strconv.Atoi(v)
+	}
+	if os.Getenv("LISTEN_PID") == strconv.Itoa(os.Getpid()) {
+		defer os.Unsetenv("LISTEN_FDS")
+		return strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	}
+	return 0, nil
+}
+
+// listen opens a listener on addr, taking over a matching inherited socket
+// if there is one.
+func listen(ctx context.Context, lc net.ListenConfig, network, addr string) (net.Listener, error) {
+	sockets.Lock()
+	defer sockets.Unlock()
+	for i, ln := range sockets.inherited {
+		if sameAddr(ln.Addr(), network, addr) {
+			sockets.inherited = append(sockets.inherited[:i], sockets.inherited[i+1:]...)
+			sockets.open = append(sockets.open, ln)
+			return ln, nil
+		}
+	}
+	if network == "unix" {
+		if err := removeStaleSocket(addr); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := lc.Listen(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	sockets.open = append(sockets.open, ln)
+	return ln, nil
+}
+
+// sameAddr reports whether a listener bound to have serves network/addr. An
+// unspecified host (":8080") only matches a wildcard listener; port 0 matches
+// any port, so a server started with -port 0 keeps its ports across restarts
+// (listeners are opened in the same order every time).
+func sameAddr(have net.Addr, network, addr string) bool {
+	if network == "unix" {
+		return have.Network() == "unix" && have.String() == addr
+	}
+	tcp, ok := have.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	want, err := net.ResolveTCPAddr(network, addr)
+	if err != nil || (want.Port != 0 && want.Port != tcp.Port) {
+		return false
+	}
+	if want.IP == nil || want.IP.IsUnspecified() {
+		return tcp.IP.IsUnspecified()
+	}
+	return want.IP.Equal(tcp.IP)
+}
+
+// restart starts a new server process with the same command line, handing
+// it every open listener. The listening sockets stay open throughout, so
+// connections made while the new process starts up wait in the accept queue
+// instead of being refused; the caller then shuts this process down
+// gracefully.
+func restart() (*os.Process, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	sockets.Lock()
+	var files []*os.File
+	for _, ln := range sockets.open {
+		if ul, ok := ln.(*net.UnixListener); ok {
+			// The new process keeps using the socket file.
+			ul.SetUnlinkOnClose(false)
+		}
+		f, err := ln.(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			sockets.Unlock()
+			return nil, fmt.Errorf("passing %s on: %w", ln.Addr(), err)
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	sockets.Unlock()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", listenFDsEnv, len(files)))
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd.Process, nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package mockserver
+
+import "os"
+
+// restartSignal is nil where there is no SIGUSR2; restarts are unavailable.
+var restartSignal os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package mockserver
+
+import (
+	"os"
+	"syscall"
+)
+
+// restartSignal asks the server to restart in place (see restart).
+var restartSignal os.Signal = syscall.SIGUSR2
@@ -0,0 +1,138 @@
+package mockserver
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// routes registers every endpoint on mux. Each built-in route gets its own
+// handler label so the scenarios show up separately in the metrics.
+func (s *server) routes(mux *http.ServeMux) {
+	handle := func(pattern, label string, h http.HandlerFunc) {
+		mux.Handle(pattern, s.routeChain(label).then(h))
+	}
+
+	// With -upstream every request except the server's own endpoints is
+	// forwarded to the real backend.
+	if s.proxy != nil {
+		handle("/", "proxy", s.proxyHandler)
+	} else {
+		s.mockRoutes(handle)
+	}
+
+	if s.requests != nil {
+		handle("GET /requests", "requests", s.requestsHandler)
+		handle("GET /requests/{id}", "requests", s.requestsByIDHandler)
+	}
+	if s.series != nil {
+		handle("GET /stats", "stats", s.statsHandler)
+		handle("DELETE /stats", "stats", s.statsHandler)
+	}
+	if s.clients != nil {
+		handle("GET /stats/clients", "stats", s.clientStatsHandler)
+		handle("DELETE /stats/clients", "stats", s.clientStatsHandler)
+	}
+	if s.inspector != nil {
+		handle("GET /__inspect", "inspect", s.inspectHandler)
+		handle("DELETE /__inspect", "inspect", s.inspectHandler)
+	}
+
+	// OpenMetrics carries the exemplars linking the request metrics to
+	// traces and test IDs.
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(s.cfg.registerer(),
+		promhttp.HandlerFor(s.cfg.gatherer(), promhttp.HandlerOpts{EnableOpenMetrics: true})))
+}
+
+// mockRoutes registers the mock response and the built-in scenarios.
+func (s *server) mockRoutes(handle func(pattern, label string, h http.HandlerFunc)) {
+	// The catch-all route honours every flag and per-request override.
+	handle("/", "root", s.mockHandler)
+
+	handle("/fast", "fast", s.fastHandler)
+	handle("/slow", "slow", s.slowHandler)
+	handle("/error", "error", s.errorHandler)
+	handle("/random", "random", s.randomHandler)
+	handle("/echo", "echo", s.echoHandler)
+	handle("POST /upload", "upload", s.uploadHandler)
+	handle("/large", "large", s.largeHandler)
+	handle("/stream", "stream", s.streamHandler)
+	handle("/trailers", "trailers", s.trailersHandler)
+	handle("/poll", "poll", s.pollHandler)
+	handle("/redirect/{n}", "redirect", s.redirectHandler)
+	handle("/burn", "burn", s.burnHandler)
+	handle("/alloc", "alloc", s.allocHandler)
+
+	handle("/auth/basic", "auth_basic", s.basicAuthHandler)
+	handle("/auth/bearer", "auth_bearer", s.bearerAuthHandler)
+	handle("/auth/api-key", "auth_api_key", s.apiKeyAuthHandler)
+	handle("POST /login", "login", s.loginHandler)
+
+	if s.cfg.staticDir != "" {
+		handle(s.cfg.staticPrefix, "static", staticHandler(s.cfg.staticDir, s.cfg.staticPrefix).ServeHTTP)
+	}
+	if s.graphql != nil {
+		handle("/graphql", "graphql", s.graphqlHandler)
+	}
+	handle("/panic", "panic", s.panicHandler)
+}
+
+// controlPath reports whether path is one of the server's own endpoints (the
+// metrics, the recorded and inspected requests, the stats, the admin API and
+// the debug endpoints), which limits and fault injection leave alone so the
+// server stays observable and controllable under test.
+func controlPath(path string) bool {
+	if path == "/metrics" || path == "/requests" || path == "/stats" || path == "/__inspect" {
+		return true
+	}
+	for _, prefix := range []string{"/requests/", "/stats/", "/admin/", "/debug/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fastHandler always sends the static JSON response immediately.
+func (s *server) fastHandler(w http.ResponseWriter, r *http.Request) {
+	if s.cache.notModified(w, r, mockETag) {
+		return
+	}
+	writeMock(w, http.StatusOK)
+}
+
+// slowHandler sends the static JSON response after -slow-delay.
+func (s *server) slowHandler(w http.ResponseWriter, r *http.Request) {
+	if !injectDelay(r.Context(), s.cfg.slowDelay) {
+		return
+	}
+	writeMock(w, http.StatusOK)
+}
+
+// errorHandler always fails with -error-status.
+func (s *server) errorHandler(w http.ResponseWriter, r *http.Request) {
+	s.behavior.Load().errors.write(w, r, s.cfg.errorStatus)
+}
+
+// randomHandler mixes a random delay from -random-delay with a random payload
+// size from -random-size.
+func (s *server) randomHandler(w http.ResponseWriter, r *http.Request) {
+	if !injectDelay(r.Context(), s.cfg.randomDelay.sample()) {
+		return
+	}
+	s.payload.write(w, http.StatusOK, s.cfg.randomSize.sample())
+}
+
+// largeHandler sends a generated payload of -large-size.
+func (s *server) largeHandler(w http.ResponseWriter, r *http.Request) {
+	if s.cache.notModified(w, r, s.payload.etag(s.cfg.largeSize)) {
+		return
+	}
+	s.payload.serve(w, r, s.cfg.largeSize)
+}
+
+// panicHandler panics on purpose, to check the recovery middleware.
+func (s *server) panicHandler(w http.ResponseWriter, r *http.Request) {
+	panic("deliberate panic from /panic")
+}
@@ -0,0 +1,94 @@
+package mockserver
+
+import (
+	"fmt"
+	"time"
+)
+
+// sequenceRule injects a fault into requests chosen by their sequence
+// number, counted from 1 since startup or the last reset, so failure windows
+// are deterministic: "every 100th request is 2s slower" is {every: 100,
+// delay: 2s}, and "requests 500 to 600 fail with 502" is {from: 500, to: 600,
+// status: 502}. Both conditions must hold when both are given.
+type sequenceRule struct {
+	Every int `json:"every,omitempty"`
+	// From and To bound the requests the rule applies to; To 0 means no
+	// upper bound.
+	From   int      `json:"from,omitempty"`
+	To     int      `json:"to,omitempty"`
+	Delay  duration `json:"delay,omitempty"`
+	Status int      `json:"status,omitempty"`
+}
+
+func (r sequenceRule) validate() error {
+	switch {
+	case r.Every < 0 || r.From < 0 || r.To < 0:
+		return fmt.Errorf("every, from and to must not be negative")
+	case r.Every == 0 && r.From == 0 && r.To == 0:
+		return fmt.Errorf("a rule needs every, or from and to")
+	case r.To > 0 && r.To < r.From:
+		return fmt.Errorf("to %d is before from %d", r.To, r.From)
+	case r.Delay < 0:
+		return fmt.Errorf("delay must not be negative")
+	case r.Status != 0 && (r.Status < 400 || r.Status > 599):
+		return fmt.Errorf("invalid status %d (want 400-599)", r.Status)
+	case r.Delay == 0 && r.Status == 0:
+		return fmt.Errorf("a rule needs a delay or a status")
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to request number n.
+func (r sequenceRule) matches(n int64) bool {
+	if n < int64(r.From) || (r.To > 0 && n > int64(r.To)) {
+		return false
+	}
+	return r.Every == 0 || n%int64(r.Every) == 0
+}
+
+// injection is the fault injected into one request.
+type injection struct {
+	delay time.Duration
+	// status is the error the request fails with, or 0, and cause what
+	// failed it: degraded, sequence, downstream or random.
+	status int
+	cause  string
+	// downstream is the time spent on each kind of simulated downstream
+	// call, included in delay.
+	downstream []timingEntry
+}
+
+// inject numbers a request and decides its fault: the behaviour's delay
+// plus any simulated downstream calls, scheduled degradation, latency ramp
+// and sequence rule delays, and the status of the first failure among the
+// degraded phase, the sequence rules, the downstream calls and the random
+// error injection.
+func (s *server) inject(b *behavior) injection {
+	n := s.seq.Add(1)
+	extra, status := s.degrade.now()
+	inj := injection{delay: b.delay.sample() + extra + s.ramp.extra()}
+	fail := func(status int, cause string) {
+		if inj.status == 0 && status != 0 {
+			inj.status, inj.cause = status, cause
+		}
+	}
+	fail(status, "degraded")
+	for _, r := range b.sequence {
+		if !r.matches(n) {
+			continue
+		}
+		inj.delay += time.Duration(r.Delay)
+		fail(r.Status, "sequence")
+	}
+	if len(b.fanout.calls) > 0 {
+		d, status, spent := b.fanout.sample()
+		inj.delay += d
+		inj.downstream = spent
+		fail(status, "downstream")
+	}
+	if inj.status == 0 {
+		status, _ := b.errors.pick()
+		fail(status, "random")
+	}
+	return inj
+}
@@ -0,0 +1,90 @@
+package mockserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+// inflight counts the requests currently being served, so shutdown can
+// report how many it drained.
+type inflight struct {
+	n atomic.Int64
+}
+
+func (f *inflight) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.n.Add(1)
+		defer f.n.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// service is a listener run by a Server. Listen opens the socket, so a
+// service that cannot start (e.g. the port is already in use) fails before
+// anything is served. Serve must return http.ErrServerClosed after Shutdown.
+type service interface {
+	Listen(ctx context.Context) error
+	Serve() error
+	Shutdown(ctx context.Context) error
+	// localAddr is the address the service is bound to, nil before
+	// Listen.
+	localAddr() net.Addr
+}
+
+// httpService adapts an http.Server, serving TLS when TLSConfig is set.
+type httpService struct {
+	*http.Server
+	// network is "tcp" or "unix"; Addr is a socket path for "unix".
+	network string
+	// lc is used to open the listener.
+	lc net.ListenConfig
+	ln net.Listener
+}
+
+func (s *httpService) Listen(ctx context.Context) (err error) {
+	s.ln, err = listen(ctx, s.lc, s.network, s.Addr)
+	return err
+}
+
+func (s *httpService) Serve() error {
+	if s.TLSConfig != nil {
+		return s.Server.ServeTLS(s.ln, "", "")
+	}
+	return s.Server.Serve(s.ln)
+}
+
+// Shutdown also closes the listener, which the http.Server does not know
+// about if it never served.
+func (s *httpService) Shutdown(ctx context.Context) error {
+	err := s.Server.Shutdown(ctx)
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	return err
+}
+
+func (s *httpService) localAddr() net.Addr {
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// removeStaleSocket removes a socket file left behind at path by a server
+// that did not shut down cleanly. Anything other than a socket is left alone,
+// so Listen fails on it.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode().Type() != os.ModeSocket {
+		return nil
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use by another server", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,26 @@
+package mockserver
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"server/metrics"
+)
+
+// staticHandler serves the files under dir at prefix, with content types
+// from the file extension, Range and conditional request support, and
+// directory listings. Requests for existing files are counted per file.
+func staticHandler(dir, prefix string) http.Handler {
+	files := http.StripPrefix(strings.TrimSuffix(prefix, "/"), http.FileServer(http.Dir(dir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		files.ServeHTTP(rec, r)
+		// Only paths that exist are labels, so random URLs cannot blow up
+		// the number of series.
+		if rec.status < 400 {
+			file := path.Clean("/" + strings.TrimPrefix(r.URL.Path, prefix))
+			metrics.StaticFile(file, rec.status, rec.bytes)
+		}
+	})
+}
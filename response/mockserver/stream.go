@@ -0,0 +1,68 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limits for /stream parameters.
+const (
+	maxStreamChunks   = 100000
+	maxStreamInterval = time.Minute
+)
+
+// streamChunk is one line of a /stream response.
+type streamChunk struct {
+	Chunk  int       `json:"chunk"`
+	Chunks int       `json:"chunks"`
+	Time   time.Time `json:"time"`
+}
+
+// streamHandler sends a newline-delimited JSON response in ?chunks=N pieces
+// (default 10), flushing each one and pausing ?interval=D (default 100ms)
+// between them. Without a Content-Length, HTTP/1.1 clients receive it with
+// Transfer-Encoding: chunked.
+func (s *server) streamHandler(w http.ResponseWriter, r *http.Request) {
+	chunks, interval, err := parseStreamParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	for i := 1; i <= chunks; i++ {
+		if i > 1 && !sleepCtx(r.Context(), interval) {
+			return
+		}
+		enc.Encode(streamChunk{Chunk: i, Chunks: chunks, Time: time.Now()})
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func parseStreamParams(r *http.Request) (int, time.Duration, error) {
+	q := r.URL.Query()
+	chunks, interval := 10, 100*time.Millisecond
+	if v := q.Get("chunks"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxStreamChunks {
+			return 0, 0, fmt.Errorf("invalid chunks %q (want 1 to %d)", v, maxStreamChunks)
+		}
+		chunks = n
+	}
+	if v := q.Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || d > maxStreamInterval {
+			return 0, 0, fmt.Errorf("invalid interval %q (want a duration up to %v)", v, maxStreamInterval)
+		}
+		interval = d
+	}
+	return chunks, interval, nil
+}
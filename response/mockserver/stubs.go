@@ -0,0 +1,481 @@
+package mockserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/template"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+
+	"server/metrics"
+)
+
+// maxStubBody bounds how much of a request body is buffered for body
+// matchers and templates.
+const maxStubBody = 1 << 20
+
+// stubFile is the top-level document of a -mocks file:
+//
+//	stubs:
+//	  - name: get-user
+//	    priority: 10
+//	    request:
+//	      method: GET
+//	      pathPattern: /users/{id}
+//	      headers:
+//	        Authorization: {contains: Bearer}
+//	    response:
+//	      status: 200
+//	      headers: {Content-Type: application/json}
+//	      body: '{"id": "{{.Params.id}}", "request": "{{uuid}}"}'
+//	      template: true
+//	      delay: 50ms
+type stubFile struct {
+	Stubs []stubDef `yaml:"stubs"`
+}
+
+// stubDef is one request matcher and the response it produces.
+type stubDef struct {
+	Name string `yaml:"name"`
+	// Priority orders stubs; higher values are tried first. Stubs with
+	// equal priority are tried in file order.
+	Priority int             `yaml:"priority"`
+	Request  requestMatchDef `yaml:"request"`
+	Response responseDef     `yaml:"response"`
+}
+
+// requestMatchDef describes which requests a stub answers. Every field that
+// is set must match.
+type requestMatchDef struct {
+	Method     string `yaml:"method"`
+	Path       string `yaml:"path"`
+	PathPrefix string `yaml:"pathPrefix"`
+	PathRegex  string `yaml:"pathRegex"`
+	// PathPattern matches paths such as /users/{id}; the parameters (and
+	// named groups in PathRegex) are available to templates as .Params.
+	PathPattern string                   `yaml:"pathPattern"`
+	Headers     map[string]valueMatchDef `yaml:"headers"`
+	Query       map[string]valueMatchDef `yaml:"query"`
+	Body        []valueMatchDef          `yaml:"body"`
+}
+
+// valueMatchDef matches a single header, query parameter or body. Exactly one
+// field should be set.
+type valueMatchDef struct {
+	EqualTo     *string `yaml:"equalTo"`
+	Contains    string  `yaml:"contains"`
+	Matches     string  `yaml:"matches"`
+	Absent      bool    `yaml:"absent"`
+	EqualToJSON any     `yaml:"equalToJson"`
+}
+
+// responseDef is the response sent by a stub.
+type responseDef struct {
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	// BodyFile is read once at load time, relative to the mocks file.
+	BodyFile string `yaml:"bodyFile"`
+	JSONBody any    `yaml:"jsonBody"`
+	// Template renders the body as a Go text/template with the request as
+	// data (see stubRequest) and the helpers in templateFuncs.
+	Template bool     `yaml:"template"`
+	Delay    duration `yaml:"delay"`
+}
+
+// stubRequest is the data available to response templates.
+type stubRequest struct {
+	Method  string
+	Path    string
+	Params  map[string]string
+	Query   url.Values
+	Headers http.Header
+	Body    string
+}
+
+// valueMatcher tests one value. present is false when the header or
+// parameter was absent.
+type valueMatcher func(value string, present bool) bool
+
+// stub is a compiled stubDef.
+type stub struct {
+	name     string
+	priority int
+
+	method         string
+	path           string
+	pathPrefix     string
+	pathRegex      *regexp.Regexp
+	pathPattern    *regexp.Regexp
+	headerMatchers map[string]valueMatcher
+	queryMatchers  map[string]valueMatcher
+	bodyMatchers   []valueMatcher
+
+	status      int
+	respHeaders http.Header
+	respBody    []byte
+	tmpl        *template.Template
+	delay       time.Duration
+
+	handler http.Handler
+}
+
+// stubTable is the compiled contents of a mocks file.
+type stubTable struct {
+	stubs []*stub
+	// needsBody is set if any stub looks at the request body.
+	needsBody bool
+}
+
+// loadStubs reads and compiles a mocks file.
+func loadStubs(path string, m *metrics.Metrics) (*stubTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f stubFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	t := &stubTable{}
+	seen := make(map[string]bool)
+	for i, def := range f.Stubs {
+		if def.Name == "" {
+			def.Name = fmt.Sprintf("stub_%d", i)
+		}
+		if seen[def.Name] {
+			return nil, fmt.Errorf("%s: duplicate stub name %q", path, def.Name)
+		}
+		seen[def.Name] = true
+		st, err := compileStub(def, filepath.Dir(path), m)
+		if err != nil {
+			return nil, fmt.Errorf("%s: stub %q: %w", path, def.Name, err)
+		}
+		t.stubs = append(t.stubs, st)
+		t.needsBody = t.needsBody || len(st.bodyMatchers) > 0 || st.tmpl != nil
+	}
+	sort.SliceStable(t.stubs, func(i, j int) bool {
+		return t.stubs[i].priority > t.stubs[j].priority
+	})
+	return t, nil
+}
+
+func compileStub(def stubDef, baseDir string, m *metrics.Metrics) (*stub, error) {
+	st := &stub{
+		name:        def.Name,
+		priority:    def.Priority,
+		method:      strings.ToUpper(def.Request.Method),
+		path:        def.Request.Path,
+		pathPrefix:  def.Request.PathPrefix,
+		status:      def.Response.Status,
+		respHeaders: make(http.Header),
+		delay:       time.Duration(def.Response.Delay),
+	}
+	if st.status == 0 {
+		st.status = http.StatusOK
+	}
+	if !validStatus(st.status) {
+		return nil, fmt.Errorf("invalid response status %d", st.status)
+	}
+	if def.Request.PathRegex != "" {
+		re, err := regexp.Compile(def.Request.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("pathRegex: %w", err)
+		}
+		st.pathRegex = re
+	}
+	if def.Request.PathPattern != "" {
+		re, err := compilePathPattern(def.Request.PathPattern)
+		if err != nil {
+			return nil, fmt.Errorf("pathPattern: %w", err)
+		}
+		st.pathPattern = re
+	}
+
+	var err error
+	if st.headerMatchers, err = compileValueMatchers(def.Request.Headers); err != nil {
+		return nil, fmt.Errorf("headers: %w", err)
+	}
+	if st.queryMatchers, err = compileValueMatchers(def.Request.Query); err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	for _, m := range def.Request.Body {
+		vm, err := compileValueMatcher(m)
+		if err != nil {
+			return nil, fmt.Errorf("body: %w", err)
+		}
+		st.bodyMatchers = append(st.bodyMatchers, vm)
+	}
+
+	for k, v := range def.Response.Headers {
+		st.respHeaders.Set(k, v)
+	}
+	switch {
+	case def.Response.BodyFile != "":
+		p := def.Response.BodyFile
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(baseDir, p)
+		}
+		if st.respBody, err = os.ReadFile(p); err != nil {
+			return nil, fmt.Errorf("bodyFile: %w", err)
+		}
+	case def.Response.JSONBody != nil:
+		if st.respBody, err = json.Marshal(def.Response.JSONBody); err != nil {
+			return nil, fmt.Errorf("jsonBody: %w", err)
+		}
+		if st.respHeaders.Get("Content-Type") == "" {
+			st.respHeaders.Set("Content-Type", "application/json")
+		}
+	default:
+		st.respBody = []byte(def.Response.Body)
+	}
+	if def.Response.Template {
+		if st.tmpl, err = template.New(def.Name).Funcs(templateFuncs).Parse(string(st.respBody)); err != nil {
+			return nil, fmt.Errorf("template: %w", err)
+		}
+	}
+
+	st.handler = m.Handler(deadlineResponse(http.HandlerFunc(st.serve)), "stub_"+def.Name)
+	return st, nil
+}
+
+func compileValueMatchers(defs map[string]valueMatchDef) (map[string]valueMatcher, error) {
+	out := make(map[string]valueMatcher, len(defs))
+	for name, def := range defs {
+		m, err := compileValueMatcher(def)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		out[name] = m
+	}
+	return out, nil
+}
+
+func compileValueMatcher(def valueMatchDef) (valueMatcher, error) {
+	switch {
+	case def.Absent:
+		return func(_ string, present bool) bool { return !present }, nil
+	case def.EqualTo != nil:
+		want := *def.EqualTo
+		return func(v string, present bool) bool { return present && v == want }, nil
+	case def.Contains != "":
+		want := def.Contains
+		return func(v string, present bool) bool { return present && strings.Contains(v, want) }, nil
+	case def.Matches != "":
+		re, err := regexp.Compile(def.Matches)
+		if err != nil {
+			return nil, err
+		}
+		return func(v string, present bool) bool { return present && re.MatchString(v) }, nil
+	case def.EqualToJSON != nil:
+		// Both sides are normalised by re-marshalling, which sorts object
+		// keys, so key order and whitespace do not matter.
+		want, err := json.Marshal(def.EqualToJSON)
+		if err != nil {
+			return nil, err
+		}
+		return func(v string, present bool) bool {
+			var got any
+			if !present || json.Unmarshal([]byte(v), &got) != nil {
+				return false
+			}
+			gotRaw, _ := json.Marshal(got)
+			return bytes.Equal(gotRaw, want)
+		}, nil
+	default:
+		return nil, errors.New("matcher needs one of equalTo, contains, matches, absent or equalToJson")
+	}
+}
+
+// matches reports whether st answers r. body is the buffered request body.
+func (st *stub) matches(r *http.Request, body []byte) bool {
+	if st.method != "" && st.method != r.Method {
+		return false
+	}
+	p := r.URL.Path
+	if st.path != "" && st.path != p {
+		return false
+	}
+	if st.pathPrefix != "" && !strings.HasPrefix(p, st.pathPrefix) {
+		return false
+	}
+	if st.pathRegex != nil && !st.pathRegex.MatchString(p) {
+		return false
+	}
+	if st.pathPattern != nil && !st.pathPattern.MatchString(p) {
+		return false
+	}
+	for name, m := range st.headerMatchers {
+		v, present := r.Header[http.CanonicalHeaderKey(name)]
+		if !m(first(v), present) {
+			return false
+		}
+	}
+	if len(st.queryMatchers) > 0 {
+		q := r.URL.Query()
+		for name, m := range st.queryMatchers {
+			v, present := q[name]
+			if !m(first(v), present) {
+				return false
+			}
+		}
+	}
+	for _, m := range st.bodyMatchers {
+		if !m(string(body), true) {
+			return false
+		}
+	}
+	return true
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// serve writes the stub's response.
+func (st *stub) serve(w http.ResponseWriter, r *http.Request) {
+	if !sleepCtx(r.Context(), st.delay) {
+		return
+	}
+
+	body := st.respBody
+	if st.tmpl != nil {
+		reqBody, _ := io.ReadAll(io.LimitReader(r.Body, maxStubBody))
+		var buf bytes.Buffer
+		params := make(map[string]string)
+		for _, re := range []*regexp.Regexp{st.pathRegex, st.pathPattern} {
+			if re != nil {
+				pathParams(re, r.URL.Path, params)
+			}
+		}
+		err := st.tmpl.Execute(&buf, stubRequest{
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			Params:  params,
+			Query:   r.URL.Query(),
+			Headers: r.Header,
+			Body:    string(reqBody),
+		})
+		if err != nil {
+			http.Error(w, "stub template error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		body = buf.Bytes()
+	}
+
+	for k, v := range st.respHeaders {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(st.status)
+	w.Write(body)
+}
+
+// stubRouter answers requests that match a stub and passes everything else to
+// the handler it wraps. The stub table can be swapped atomically while
+// requests are in flight: each request keeps using the table it started with.
+type stubRouter struct {
+	path string
+	// metrics records the requests of every stub.
+	metrics *metrics.Metrics
+	table   atomic.Pointer[stubTable]
+}
+
+// newStubRouter loads the stubs in path.
+func newStubRouter(path string, m *metrics.Metrics) (*stubRouter, error) {
+	rt := &stubRouter{path: path, metrics: m}
+	if err := rt.reload(); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// reload re-reads the mocks file. On error the current table is kept.
+func (rt *stubRouter) reload() error {
+	t, err := loadStubs(rt.path, rt.metrics)
+	if err != nil {
+		return err
+	}
+	rt.table.Store(t)
+	log.Printf("Loaded %d stubs from %s", len(t.stubs), rt.path)
+	return nil
+}
+
+// watch reloads the stubs whenever the process receives SIGHUP or the file's
+// modification time or size changes, checking every interval, until done is
+// closed.
+func (rt *stubRouter) watch(interval time.Duration, done <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last, _ := os.Stat(rt.path)
+	for {
+		select {
+		case <-done:
+			return
+		case <-hup:
+			log.Printf("SIGHUP received, reloading %s", rt.path)
+		case <-ticker.C:
+			fi, err := os.Stat(rt.path)
+			if err != nil || (last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size()) {
+				continue
+			}
+			last = fi
+			log.Printf("%s changed, reloading", rt.path)
+		}
+		if err := rt.reload(); err != nil {
+			log.Printf("ERROR reloading stubs, keeping previous definitions: %v", err)
+		}
+	}
+}
+
+func (rt *stubRouter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt.serve(w, r, next)
+	})
+}
+
+func (rt *stubRouter) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	t := rt.table.Load()
+	var body []byte
+	if t.needsBody && r.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxStubBody))
+		if err != nil {
+			http.Error(w, "error reading request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Let the stub (or the fallback handler) read the body again.
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	}
+	for _, st := range t.stubs {
+		if st.matches(r, body) {
+			st.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	next.ServeHTTP(w, r)
+}
@@ -0,0 +1,114 @@
+package mockserver
+
+import (
+	crand "crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are the helpers available to response templates, e.g.
+//
+//	{"id": "{{uuid}}", "user": "{{.Params.id}}", "score": {{randInt 1 100}},
+//	 "at": "{{now.Format "2006-01-02T15:04:05Z07:00"}}", "q": {{json .Query}}}
+var templateFuncs = template.FuncMap{
+	// uuid returns a random (version 4) UUID.
+	"uuid": newUUID,
+	// randInt returns a random integer in [min, max].
+	"randInt": func(min, max int) int {
+		if max <= min {
+			return min
+		}
+		return min + rand.IntN(max-min+1)
+	},
+	// randFloat returns a random number in [0, 1).
+	"randFloat": rand.Float64,
+	// randString returns n random letters and digits.
+	"randString": func(n int) string {
+		const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+		b := make([]byte, max(n, 0))
+		for i := range b {
+			b[i] = chars[rand.IntN(len(chars))]
+		}
+		return string(b)
+	},
+	// randChoice returns one of its arguments at random.
+	"randChoice": func(choices ...any) any {
+		if len(choices) == 0 {
+			return nil
+		}
+		return choices[rand.IntN(len(choices))]
+	},
+	"now":   time.Now,
+	"unix":  func() int64 { return time.Now().Unix() },
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// json encodes a value as JSON, for safely embedding request data in
+	// JSON bodies.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	crand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+var paramName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// compilePathPattern turns a path pattern such as /users/{id}/files/{rest...}
+// into an anchored regexp whose named groups capture the parameters. {name}
+// matches one path segment; {name...}, only allowed last, matches the rest
+// of the path.
+func compilePathPattern(pattern string) (*regexp.Regexp, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern %q must start with /", pattern)
+	}
+	segments := strings.Split(pattern[1:], "/")
+	var b strings.Builder
+	b.WriteString("^")
+	for i, seg := range segments {
+		b.WriteString("/")
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") || len(seg) < 2 {
+			b.WriteString(regexp.QuoteMeta(seg))
+			continue
+		}
+		name := seg[1 : len(seg)-1]
+		expr := "[^/]+"
+		if n, rest := strings.CutSuffix(name, "..."); rest {
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("pattern %q: {%s} must be the last segment", pattern, name)
+			}
+			name, expr = n, ".*"
+		}
+		if !paramName.MatchString(name) {
+			return nil, fmt.Errorf("pattern %q: invalid parameter name %q", pattern, name)
+		}
+		fmt.Fprintf(&b, "(?P<%s>%s)", name, expr)
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// pathParams returns the named groups of re matched against path.
+func pathParams(re *regexp.Regexp, path string, params map[string]string) {
+	m := re.FindStringSubmatch(path)
+	if m == nil {
+		return
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			params[name] = m[i]
+		}
+	}
+}
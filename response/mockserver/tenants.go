@@ -0,0 +1,107 @@
+package mockserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"server/metrics"
+)
+
+// tenantSpec is a tenant from -tenant: the requests for one emulated service,
+// picked by Host header (or -tenant-header value), served with their own
+// behaviour.
+type tenantSpec struct {
+	name     string
+	key      string
+	behavior behavior
+}
+
+// parseTenantSpec parses a -tenant value: the Host (or -tenant-header value)
+// of the tenant, optionally followed by query-style options, e.g.
+//
+//	payments.local?name=payments&delay=100ms&error-rate=0.1
+//
+// The options are name (the tenant label in the metrics, by default the key)
+// and the behaviour settings of -listen. Unset behaviour settings are
+// inherited from base.
+func parseTenantSpec(s string, base behavior) (tenantSpec, error) {
+	key, rawOpts, _ := strings.Cut(s, "?")
+	opts, err := url.ParseQuery(rawOpts)
+	if err != nil {
+		return tenantSpec{}, err
+	}
+	t := tenantSpec{name: key, key: strings.ToLower(key), behavior: base}
+	for k, values := range opts {
+		v := values[len(values)-1]
+		if k == "name" {
+			t.name = v
+			continue
+		}
+		known, err := setBehaviorOption(&t.behavior, k, v)
+		if !known {
+			return tenantSpec{}, fmt.Errorf("unknown option %q", k)
+		}
+		if err != nil {
+			return tenantSpec{}, fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	if key == "" {
+		return tenantSpec{}, fmt.Errorf("missing host or header value in %q", s)
+	}
+	if err := t.behavior.validate(); err != nil {
+		return tenantSpec{}, err
+	}
+	return t, nil
+}
+
+// tenantRouter sends each request to the mock of its tenant, chosen by the
+// Host header without the port or, if set, by the value of a header.
+// Requests of unknown tenants, and those for the server's own endpoints, go
+// to the main server.
+type tenantRouter struct {
+	header   string
+	tenants  map[string]http.Handler
+	fallback http.Handler
+}
+
+// tenantRouter returns a handler routing the tenants of -tenant to their
+// own copies of the mock, and every other request to main. The copies only
+// swap the behaviour: the rate, concurrency and cache limits are those of
+// the whole server.
+func (s *server) tenantRouter(main http.Handler) http.Handler {
+	rt := &tenantRouter{
+		header:   s.cfg.tenantHeader,
+		tenants:  make(map[string]http.Handler),
+		fallback: main,
+	}
+	for _, t := range s.cfg.tenants {
+		ts := s.withBehavior(t.behavior)
+		tmux := http.NewServeMux()
+		ts.routes(tmux)
+		rt.tenants[t.key] = metrics.WithTenant(t.name, ts.handler(tmux))
+	}
+	return rt
+}
+
+func (rt *tenantRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h := rt.fallback
+	if !controlPath(r.URL.Path) {
+		if t, ok := rt.tenants[strings.ToLower(rt.key(r))]; ok {
+			h = t
+		}
+	}
+	h.ServeHTTP(w, r)
+}
+
+func (rt *tenantRouter) key(r *http.Request) string {
+	if rt.header != "" {
+		return r.Header.Get(rt.header)
+	}
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		return host
+	}
+	return r.Host
+}
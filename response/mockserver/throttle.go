@@ -0,0 +1,88 @@
+package mockserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// throttleTick is how often a throttled response sends a burst of bytes.
+const throttleTick = 50 * time.Millisecond
+
+// parseBandwidth parses a rate such as "100kb/s" or "1mb" (per second).
+func parseBandwidth(s string) (int64, error) {
+	n, err := parseSize(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid bandwidth %q (want e.g. 100kb/s)", s)
+	}
+	return n, nil
+}
+
+// throttleBandwidth limits how fast response bodies are written, to simulate
+// slow backends or constrained links. The limit is def bytes per second (0
+// for none) unless the request overrides it with ?bandwidth= or the
+// x-inject-bandwidth header.
+func throttleBandwidth(def int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rate := def
+		if v := overrideValue(r, "bandwidth"); v != "" && !controlPath(r.URL.Path) {
+			n, err := parseBandwidth(v)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			rate = n
+		}
+		if rate <= 0 || controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&throttledWriter{ResponseWriter: w, r: r, rate: rate}, r)
+	})
+}
+
+// throttledWriter writes the body in bursts of a tick's worth of bytes,
+// flushing each one and sleeping to keep the average at rate bytes per
+// second.
+type throttledWriter struct {
+	http.ResponseWriter
+	r     *http.Request
+	rate  int64
+	start time.Time
+	sent  int64
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	if tw.start.IsZero() {
+		tw.start = time.Now()
+	}
+	burst := max(tw.rate*int64(throttleTick)/int64(time.Second), 1)
+	written := 0
+	for len(p) > 0 {
+		n := min(int64(len(p)), burst)
+		m, err := tw.ResponseWriter.Write(p[:n])
+		written += m
+		tw.sent += int64(m)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		http.NewResponseController(tw.ResponseWriter).Flush()
+
+		due := tw.start.Add(time.Duration(tw.sent * int64(time.Second) / tw.rate))
+		if !sleepCtx(tw.r.Context(), time.Until(due)) {
+			return written, tw.r.Context().Err()
+		}
+	}
+	return written, nil
+}
+
+func (tw *throttledWriter) Flush() {
+	http.NewResponseController(tw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (tw *throttledWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
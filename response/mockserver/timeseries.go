@@ -0,0 +1,169 @@
+package mockserver
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// requestSeries aggregates the requests per second over a sliding window,
+// for /stats: counts, errors and a latency histogram for every second, so
+// quick checks and latency heatmaps need no Prometheus. The seconds are
+// kept in a ring indexed by their Unix time.
+type requestSeries struct {
+	mu    sync.Mutex
+	slots []secondStats
+}
+
+// secondStats are the requests of one second. An entry whose sec is not
+// the one looked up is stale and counts as empty.
+type secondStats struct {
+	sec int64
+	clientEntry
+}
+
+func newRequestSeries(window time.Duration) *requestSeries {
+	return &requestSeries{slots: make([]secondStats, int(window/time.Second))}
+}
+
+func (rs *requestSeries) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if controlPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		rs.record(start, rec.status, time.Since(start))
+	})
+}
+
+// record counts a request started at start.
+func (rs *requestSeries) record(start time.Time, status int, latency time.Duration) {
+	sec := start.Unix()
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	slot := &rs.slots[sec%int64(len(rs.slots))]
+	if slot.sec != sec {
+		*slot = secondStats{sec: sec}
+	}
+	slot.requests++
+	if status >= 500 {
+		slot.errors++
+	}
+	slot.maxLatency = max(slot.maxLatency, latency)
+	slot.buckets[latencyBucket(latency)]++
+}
+
+// seriesStats is the /stats response.
+type seriesStats struct {
+	Window duration `json:"window"`
+	// Total sums up the seconds listed.
+	Total   secondSummary   `json:"total"`
+	Seconds []secondSummary `json:"seconds"`
+}
+
+// secondSummary is one second in /stats, or their total.
+type secondSummary struct {
+	// Time is the start of the second; unset for the total.
+	Time     *time.Time `json:"time,omitempty"`
+	Requests int64      `json:"requests"`
+	Errors   int64      `json:"errors"`
+	P50      duration   `json:"p50"`
+	P90      duration   `json:"p90"`
+	P99      duration   `json:"p99"`
+	Max      duration   `json:"max"`
+	// Buckets are the non-empty buckets of the latency histogram, for
+	// heatmaps.
+	Buckets []latencyCount `json:"buckets,omitempty"`
+}
+
+// latencyCount is the number of requests with a latency of at most Le and
+// above the bound of the bucket before.
+type latencyCount struct {
+	Le    duration `json:"le"`
+	Count int64    `json:"count"`
+}
+
+// summary lists the seconds of the last window with requests, oldest
+// first, skipping the current one, which is still being counted.
+func (rs *requestSeries) summary(now time.Time, window time.Duration) seriesStats {
+	n := min(int64(window/time.Second), int64(len(rs.slots)))
+	out := seriesStats{Window: duration(time.Duration(n) * time.Second), Seconds: []secondSummary{}}
+	var total clientEntry
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	last := now.Unix() - 1
+	for sec := last - n + 1; sec <= last; sec++ {
+		slot := &rs.slots[sec%int64(len(rs.slots))]
+		if slot.sec != sec || slot.requests == 0 {
+			continue
+		}
+		t := time.Unix(sec, 0).UTC()
+		s := slot.summary()
+		s.Time = &t
+		out.Seconds = append(out.Seconds, s)
+
+		total.requests += slot.requests
+		total.errors += slot.errors
+		total.maxLatency = max(total.maxLatency, slot.maxLatency)
+		for i, c := range slot.buckets {
+			total.buckets[i] += c
+		}
+	}
+	out.Total = total.summary()
+	out.Total.Buckets = nil
+	return out
+}
+
+func (e *clientEntry) summary() secondSummary {
+	s := secondSummary{Requests: e.requests, Errors: e.errors, Max: duration(e.maxLatency)}
+	if e.requests == 0 {
+		return s
+	}
+	s.P50 = duration(e.quantile(0.5))
+	s.P90 = duration(e.quantile(0.9))
+	s.P99 = duration(e.quantile(0.99))
+	for i, c := range e.buckets {
+		if c > 0 {
+			s.Buckets = append(s.Buckets, latencyCount{Le: duration(latencyBound(i)), Count: c})
+		}
+	}
+	return s
+}
+
+// latencyBound is the upper bound of latency bucket i; the last one is
+// open-ended.
+func latencyBound(i int) time.Duration {
+	return time.Duration(float64(latencyBase) * math.Pow(latencyGrowth, float64(i)))
+}
+
+// reset forgets every second counted.
+func (rs *requestSeries) reset() {
+	rs.mu.Lock()
+	clear(rs.slots)
+	rs.mu.Unlock()
+}
+
+// statsHandler answers GET /stats with the requests of every second of the
+// -stats-window, or of the last ?window=1m of it; DELETE clears them.
+func (s *server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		s.series.reset()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	window := s.cfg.statsWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			http.Error(w, "invalid window: want a duration of at least 1s", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	writeJSON(w, http.StatusOK, s.series.summary(time.Now(), window))
+}
@@ -0,0 +1,103 @@
+package mockserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type timingsKey struct{}
+
+// timings are the named phases of a request reported in its Server-Timing
+// header.
+type timings struct {
+	mu      sync.Mutex
+	entries []timingEntry
+}
+
+type timingEntry struct {
+	name, desc string
+	dur        time.Duration
+}
+
+// addTiming reports a phase of the request with context ctx in the
+// Server-Timing header, if it is enabled.
+func addTiming(ctx context.Context, name, desc string, d time.Duration) {
+	t, ok := ctx.Value(timingsKey{}).(*timings)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	t.entries = append(t.entries, timingEntry{name, desc, d})
+	t.mu.Unlock()
+}
+
+// serverTiming adds a Server-Timing header to every response with the time
+// the server spent before sending it ("total") and the phases reported by the
+// handlers, such as the injected delay, so clients can tell server time from
+// network time.
+func serverTiming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := &timings{}
+		tw := &timingWriter{ResponseWriter: w, start: time.Now(), t: t}
+		next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), timingsKey{}, t)))
+	})
+}
+
+// timingWriter sets the Server-Timing header just before the response
+// header is sent.
+type timingWriter struct {
+	http.ResponseWriter
+	start time.Time
+	t     *timings
+	done  bool
+}
+
+func (tw *timingWriter) setHeader() {
+	if tw.done {
+		return
+	}
+	tw.done = true
+	tw.t.mu.Lock()
+	defer tw.t.mu.Unlock()
+	parts := make([]string, 0, len(tw.t.entries)+1)
+	for _, e := range tw.t.entries {
+		parts = append(parts, timingMetric(e.name, e.desc, e.dur))
+	}
+	parts = append(parts, timingMetric("total", "", time.Since(tw.start)))
+	tw.Header().Add("Server-Timing", strings.Join(parts, ", "))
+}
+
+// timingMetric formats one Server-Timing metric; durations are in
+// milliseconds.
+func timingMetric(name, desc string, d time.Duration) string {
+	m := fmt.Sprintf("%s;dur=%.3f", name, float64(d)/float64(time.Millisecond))
+	if desc != "" {
+		m += fmt.Sprintf(";desc=%q", desc)
+	}
+	return m
+}
+
+func (tw *timingWriter) WriteHeader(code int) {
+	if code >= 200 {
+		tw.setHeader()
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timingWriter) Write(b []byte) (int, error) {
+	tw.setHeader()
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *timingWriter) Flush() {
+	tw.setHeader()
+	http.NewResponseController(tw.ResponseWriter).Flush()
+}
+
+func (tw *timingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
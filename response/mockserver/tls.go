@@ -0,0 +1,122 @@
+package mockserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"server/metrics"
+)
+
+// tlsEnabled reports whether any TLS flag was given. The mTLS flags only make
+// sense with TLS, so they enable it too (and then fail in tlsConfig if no
+// server certificate source was given).
+func (c *config) tlsEnabled() bool {
+	return c.tlsCert != "" || c.tlsKey != "" || c.tlsSelfSigned || c.clientCA != "" || c.requireClientCert
+}
+
+// listenerTLSConfig returns the TLS configuration for a -listen listener
+// with the tls option: the main one when TLS is configured, and otherwise one
+// with a self-signed certificate.
+func (c *config) listenerTLSConfig() (*tls.Config, error) {
+	if c.tlsEnabled() {
+		return c.tlsConfig()
+	}
+	selfSigned := *c
+	selfSigned.tlsSelfSigned = true
+	return selfSigned.tlsConfig()
+}
+
+// tlsConfig builds the server TLS configuration from -tls-cert/-tls-key, or
+// from a freshly generated self-signed certificate with -tls-self-signed.
+// HTTP/2 is negotiated automatically via ALPN.
+func (c *config) tlsConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	switch {
+	case c.tlsCert != "" && c.tlsKey != "":
+		cert, err = tls.LoadX509KeyPair(c.tlsCert, c.tlsKey)
+	case c.tlsCert != "" || c.tlsKey != "":
+		return nil, errors.New("-tls-cert and -tls-key must be given together")
+	case c.tlsSelfSigned:
+		cert, err = selfSignedCert(c.host)
+	default:
+		return nil, errors.New("client certificate verification needs -tls-cert/-tls-key or -tls-self-signed")
+	}
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	// mTLS: verify client certificates against -client-ca, optionally
+	// refusing handshakes without one.
+	switch {
+	case c.clientCA != "":
+		pem, err := os.ReadFile(c.clientCA)
+		if err != nil {
+			return nil, fmt.Errorf("reading -client-ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", c.clientCA)
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.requireClientCert {
+			tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	case c.requireClientCert:
+		return nil, errors.New("-require-client-cert needs -client-ca")
+	}
+	return metrics.InstrumentTLS(tlsCfg), nil
+}
+
+// selfSignedCert generates an ECDSA certificate valid for a year for
+// localhost, the loopback addresses and host (if set).
+func selfSignedCert(host string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Mock Server"}, CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host != "" {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
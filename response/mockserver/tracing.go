@@ -0,0 +1,125 @@
+package mockserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the server's spans. Until setupTracing installs a provider
+// it hands out no-op spans.
+var tracer = otel.Tracer("server")
+
+// setupTracing exports the server's spans over OTLP/HTTP to endpoint,
+// sampling sampleRate of the traces that the client did not already decide
+// on, and returns a function that flushes the pending spans.
+func setupTracing(endpoint string, sampleRate float64) (func(), error) {
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("mock-server")),
+		resource.WithFromEnv(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRate))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			log.Printf("ERROR flushing traces: %v", err)
+		}
+	}, nil
+}
+
+// tracesEndpoint returns the OTLP/HTTP URL for traces given either the full
+// URL or just the collector's base URL (e.g. http://localhost:4318).
+func tracesEndpoint(s string) (string, error) {
+	if !strings.HasPrefix(s, "http://") && !strings.HasPrefix(s, "https://") {
+		return "", fmt.Errorf("%q is not an http:// or https:// URL", s)
+	}
+	if strings.Count(s, "/") == 2 || strings.HasSuffix(s, "/") {
+		s = strings.TrimSuffix(s, "/") + "/v1/traces"
+	}
+	return s, nil
+}
+
+type serverSpanKey struct{}
+
+// traceRequests starts a server span for every request, continuing the trace
+// of the client when the request carries a traceparent header.
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ServerAddress(r.Host),
+				semconv.ClientAddress(clientIP(r)),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				semconv.NetworkProtocolVersion(strings.TrimPrefix(r.Proto, "HTTP/")),
+			),
+		)
+		defer span.End()
+		ctx = context.WithValue(ctx, serverSpanKey{}, span)
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// traceRoute names the server span of the request after the route that
+// served it, e.g. "GET /redirect/{n}".
+func traceRoute(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if span, ok := r.Context().Value(serverSpanKey{}).(trace.Span); ok && r.Pattern != "" {
+			route := r.Pattern
+			if _, path, ok := strings.Cut(route, " "); ok {
+				route = path
+			}
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		next(w, r)
+	}
+}
+
+// tracePhase records the time next spends on a request as a child span
+// called name.
+func tracePhase(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), name)
+		defer span.End()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
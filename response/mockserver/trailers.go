@@ -0,0 +1,90 @@
+package mockserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// maxTrailerChunks bounds the ?chunks parameter of /trailers.
+const maxTrailerChunks = 1000
+
+// trailersHandler sends a generated body of ?size= bytes (default 64kb) in
+// ?chunks= flushed pieces (default 4), ?interval= apart, and then the
+// trailers it declared up front: X-Checksum-Sha256 (of the body before any
+// Content-Encoding), X-Body-Bytes and every ?trailer=Name:Value.
+func (s *server) trailersHandler(w http.ResponseWriter, r *http.Request) {
+	size, chunks, interval, extra, err := parseTrailersParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	names := []string{"X-Checksum-Sha256", "X-Body-Bytes"}
+	for name := range extra {
+		names = append(names, name)
+	}
+	w.Header().Set("Trailer", strings.Join(names, ", "))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	h := sha256.New()
+	body := io.MultiWriter(w, h)
+	rc := http.NewResponseController(w)
+	var off int64
+	for i := range int64(chunks) {
+		if i > 0 && !sleepCtx(r.Context(), interval) {
+			return
+		}
+		n := size/int64(chunks) + min(1, max(0, size%int64(chunks)-i))
+		s.payload.writeBody(body, off, n)
+		off += n
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+
+	w.Header().Set("X-Checksum-Sha256", hex.EncodeToString(h.Sum(nil)))
+	w.Header().Set("X-Body-Bytes", strconv.FormatInt(off, 10))
+	for name, value := range extra {
+		w.Header().Set(name, value)
+	}
+}
+
+func parseTrailersParams(r *http.Request) (size int64, chunks int, interval time.Duration, extra map[string]string, err error) {
+	q := r.URL.Query()
+	size, chunks = 64<<10, 4
+	if v := q.Get("size"); v != "" {
+		if size, err = parseSize(v); err != nil {
+			return 0, 0, 0, nil, fmt.Errorf("invalid size %q: %v", v, err)
+		}
+	}
+	if v := q.Get("chunks"); v != "" {
+		if chunks, err = strconv.Atoi(v); err != nil || chunks < 1 || chunks > maxTrailerChunks {
+			return 0, 0, 0, nil, fmt.Errorf("invalid chunks %q (want 1 to %d)", v, maxTrailerChunks)
+		}
+	}
+	if v := q.Get("interval"); v != "" {
+		if interval, err = time.ParseDuration(v); err != nil || interval < 0 || interval > maxStreamInterval {
+			return 0, 0, 0, nil, fmt.Errorf("invalid interval %q (want a duration up to %v)", v, maxStreamInterval)
+		}
+	}
+	extra = make(map[string]string)
+	for _, t := range q["trailer"] {
+		name, value, ok := strings.Cut(t, ":")
+		name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+		if !ok || !httpguts.ValidHeaderFieldName(name) || !httpguts.ValidTrailerHeader(name) || !httpguts.ValidHeaderFieldValue(value) {
+			return 0, 0, 0, nil, fmt.Errorf("invalid trailer %q (want Name:Value)", t)
+		}
+		extra[name] = strings.TrimSpace(value)
+	}
+	return size, chunks, interval, extra, nil
+}
@@ -0,0 +1,114 @@
+package mockserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"server/metrics"
+)
+
+// uploadPart describes one part of a multipart upload.
+type uploadPart struct {
+	Name        string `json:"name"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	SavedAs     string `json:"saved_as,omitempty"`
+}
+
+// uploadResponse is the body sent by /upload.
+type uploadResponse struct {
+	Parts          []uploadPart `json:"parts"`
+	TotalBytes     int64        `json:"total_bytes"`
+	Duration       string       `json:"duration"`
+	BytesPerSecond float64      `json:"bytes_per_second"`
+}
+
+// uploadHandler accepts a multipart/form-data body and reports the size and
+// SHA-256 of every part. Parts are streamed, never held in memory, and
+// discarded unless -save-uploads names a directory to keep them in.
+func (s *server) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "want a multipart/form-data body: " + err.Error()})
+		return
+	}
+
+	start := time.Now()
+	resp := uploadResponse{Parts: []uploadPart{}}
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.uploadFailed(w, err)
+			return
+		}
+		part := uploadPart{Name: p.FormName(), Filename: p.FileName(), ContentType: p.Header.Get("Content-Type")}
+
+		var dst io.Writer = io.Discard
+		var file *os.File
+		if s.cfg.saveUploads != "" {
+			file, err = os.CreateTemp(s.cfg.saveUploads, "upload-*-"+uploadName(part))
+			if err != nil {
+				log.Printf("Upload: %v", err)
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "cannot save upload"})
+				return
+			}
+			dst, part.SavedAs = file, file.Name()
+		}
+		h := sha256.New()
+		part.Size, err = io.Copy(io.MultiWriter(dst, h), p)
+		if file != nil {
+			file.Close()
+		}
+		resp.TotalBytes += part.Size
+		metrics.UploadBytes(part.Size)
+		if err != nil {
+			s.uploadFailed(w, err)
+			return
+		}
+		part.SHA256 = hex.EncodeToString(h.Sum(nil))
+		resp.Parts = append(resp.Parts, part)
+	}
+
+	elapsed := time.Since(start)
+	resp.Duration = elapsed.String()
+	if elapsed > 0 {
+		resp.BytesPerSecond = float64(resp.TotalBytes) / elapsed.Seconds()
+	}
+	metrics.Upload(len(resp.Parts), resp.TotalBytes, elapsed)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *server) uploadFailed(w http.ResponseWriter, err error) {
+	if bodyTooLarge(err) {
+		rejectBody(w, http.StatusRequestEntityTooLarge, "too_large", "request body too large")
+		return
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		// The client went away mid-upload.
+		return
+	}
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid multipart body: " + err.Error()})
+}
+
+// uploadName returns a safe file name suffix for a part. Only the base name
+// is used, so a crafted file name cannot escape the upload directory.
+func uploadName(p uploadPart) string {
+	for _, name := range []string{p.Filename, p.Name} {
+		if base := filepath.Base(name); base != "." && base != "/" && base != ".." {
+			return base
+		}
+	}
+	return "part"
+}